@@ -2,47 +2,84 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
+	"github.com/BalanceBalls/report-generator/internal/backup"
 	"github.com/BalanceBalls/report-generator/internal/bot"
+	"github.com/BalanceBalls/report-generator/internal/logger"
+	"github.com/BalanceBalls/report-generator/internal/server"
+	"github.com/BalanceBalls/report-generator/internal/storage"
+	"github.com/BalanceBalls/report-generator/internal/storage/memory"
+	"github.com/BalanceBalls/report-generator/internal/storage/postgres"
+	"github.com/BalanceBalls/report-generator/internal/storage/sqlite"
 	"github.com/caarlos0/env/v10"
 	"github.com/joho/godotenv"
 )
 
+var (
+	rotateTokenKeys = flag.Bool("rotate-token-keys", false,
+		"re-encrypt stored tokens with the key set by TOKEN_KEY_ID and exit")
+	pendingMigrations = flag.Bool("pending-migrations", false,
+		"print database migrations which have not been applied yet and exit")
+)
+
 func main() {
-	// Add tests
-	// log backups
-	// db backups
+	flag.Usage = usage
+	flag.Parse()
 
-	logFile, fileErr := os.Create("bot.log")
-	if fileErr != nil {
-		panic(fileErr)
-	}
-	defer func() {
-		err := logFile.Close()
-		panic(err)
-	}()
+	// Cancelled on SIGINT or SIGTERM to shut down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	logger := slog.New(slog.NewJSONHandler(logFile, nil))
-	slog.SetDefault(logger)
+	if flag.Arg(0) == replayCmd {
+		if flag.NArg() != 2 {
+			usage()
+			os.Exit(2)
+		}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+		if err := replayRecording(ctx, os.Stdout, flag.Arg(1)); err != nil {
+			fmt.Fprintf(os.Stderr, "replay failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	slog.InfoContext(ctx, "bot starting...")
+	// Logs go to stderr until the configured output is set up
 	err := godotenv.Load(".env")
 	if err != nil {
-		slog.ErrorContext(ctx, "error loading .env file: %s", err)
+		slog.ErrorContext(ctx, "error loading .env file", "reason", err)
 		panic(err)
 	}
 	cfg := bot.Config{}
 
 	err = env.Parse(&cfg)
 	if err != nil {
-		slog.ErrorContext(ctx, "unable to parse ennvironment variables: %e", err)
+		slog.ErrorContext(ctx, "unable to parse ennvironment variables", "reason", err)
+		panic(err)
+	}
+
+	logFile, err := setupLogger(&cfg)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to set up logger", "reason", err)
 		panic(err)
 	}
+	if logFile != nil {
+		defer func() {
+			if err := logFile.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "could not close log file: %v\n", err)
+			}
+		}()
+	}
+
+	slog.InfoContext(ctx, "bot starting...")
 
 	defer func() {
 		if err := recover(); err != nil {
@@ -51,6 +88,215 @@ func main() {
 		}
 	}()
 
-	bot := bot.New(&cfg)
+	tokenCipher, err := storage.NewTokenCipher(cfg.TokenKeys, cfg.TokenKeyId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to initialize token encryption", "reason", err)
+		panic(err)
+	}
+
+	store, err := openStorage(&cfg, tokenCipher)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to open storage", "reason", err, "driver", cfg.StorageDriver)
+		panic(err)
+	}
+
+	if *pendingMigrations {
+		migrator, ok := store.(migratableStorage)
+		if !ok {
+			fmt.Printf("%s storage has no migrations\n", cfg.StorageDriver)
+			return
+		}
+
+		migrations, err := migrator.PendingMigrations(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "could not get pending migrations", "reason", err)
+			panic(err)
+		}
+
+		if len(migrations) == 0 {
+			fmt.Println("database is up to date")
+		}
+
+		for _, migration := range migrations {
+			fmt.Printf("%04d_%s\n", migration.Version, migration.Name)
+		}
+		return
+	}
+
+	if flag.Arg(0) == restoreCmd {
+		if flag.NArg() != 2 {
+			usage()
+			os.Exit(2)
+		}
+
+		if err := restoreBackup(ctx, store, flag.Arg(1)); err != nil {
+			slog.ErrorContext(ctx, "backup restore failed", "reason", err, "path", flag.Arg(1))
+			fmt.Fprintf(os.Stderr, "backup restore failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == recomputeCmd {
+		if flag.NArg() != 3 {
+			usage()
+			os.Exit(2)
+		}
+
+		if err := recomputeReport(ctx, os.Stdout, store, flag.Arg(1), flag.Arg(2)); err != nil {
+			fmt.Fprintf(os.Stderr, "recompute failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *rotateTokenKeys {
+		rotator, ok := store.(tokenRotatingStorage)
+		if !ok {
+			fmt.Printf("%s storage does not encrypt tokens\n", cfg.StorageDriver)
+			return
+		}
+
+		rotated, err := rotator.RotateTokens(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "token keys rotation failed", "reason", err)
+			panic(err)
+		}
+
+		slog.InfoContext(ctx, "token keys rotation finished", "rotated", rotated, "key_id", cfg.TokenKeyId)
+		return
+	}
+
+	// Background services stop with the context
+	var services sync.WaitGroup
+
+	var backups bot.Backuper
+	if source, ok := store.(backup.Source); ok {
+		manager := backup.NewManager(source, cfg.BackupDir, cfg.BackupRetention)
+		backups = manager
+
+		if cfg.BackupInterval > 0 {
+			services.Add(1)
+			go func() {
+				defer services.Done()
+				manager.Run(ctx, cfg.BackupInterval)
+			}()
+		}
+	}
+
+	bot := bot.New(&cfg, store, backups)
+
+	if cfg.HttpAddr != "" {
+		srv := server.New(cfg.HttpAddr, bot.Checks()...)
+		services.Add(1)
+		go func() {
+			defer services.Done()
+			if err := srv.Run(ctx); err != nil {
+				slog.ErrorContext(ctx, "http server stopped", "reason", err)
+			}
+		}()
+	}
+
+	// Returns on shutdown when updates being processed have finished
 	bot.Serve(ctx)
+	services.Wait()
+
+	if closer, ok := store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			slog.ErrorContext(ctx, "could not close storage", "reason", err)
+		}
+	}
+
+	slog.InfoContext(ctx, "bot stopped")
+}
+
+const restoreCmd = "restore"
+
+// Sets the default logger writing JSON to the configured output.
+// Returns the log file writer to be closed on exit, nil when logs go to stdout only
+func setupLogger(cfg *bot.Config) (*logger.RotatingWriter, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q: %w", cfg.LogLevel, err)
+	}
+
+	var output io.Writer
+	var file *logger.RotatingWriter
+
+	switch cfg.LogOutput {
+	case bot.LogOutputStdout:
+		output = os.Stdout
+	case bot.LogOutputFile, bot.LogOutputBoth:
+		var err error
+		file, err = logger.NewRotatingWriter(
+			cfg.LogFile, int64(cfg.LogMaxSizeMb)<<20, cfg.LogRotateInterval, cfg.LogRetention)
+		if err != nil {
+			return nil, err
+		}
+
+		output = file
+		if cfg.LogOutput == bot.LogOutputBoth {
+			output = io.MultiWriter(file, os.Stdout)
+		}
+	default:
+		return nil, fmt.Errorf("unknown log output %q", cfg.LogOutput)
+	}
+
+	handler := slog.NewJSONHandler(output, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(handler))
+
+	return file, nil
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage:\n  %s [flags]\n  %s %s <backup file>\n  %s %s <recording file>\n  %s %s <user id> <YYYY-MM-DD>\n\nFlags:\n",
+		os.Args[0], os.Args[0], restoreCmd, os.Args[0], replayCmd, os.Args[0], recomputeCmd)
+	flag.PrintDefaults()
+}
+
+// Loads the backup archive into the empty storage creating its schema first
+func restoreBackup(ctx context.Context, store bot.Storage, path string) error {
+	target, ok := store.(backup.Target)
+	if !ok {
+		return errors.New("storage does not support restoring backups")
+	}
+
+	if err := store.Up(ctx); err != nil {
+		return fmt.Errorf("could not prepare storage: %w", err)
+	}
+
+	archive, err := backup.Restore(ctx, target, path)
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "backup restored",
+		"path", path, "created_at", archive.CreatedAt, "users", len(archive.Users), "reports", len(archive.Reports))
+	fmt.Printf("restored %d users and %d reports from %s\n", len(archive.Users), len(archive.Reports), path)
+
+	return nil
+}
+
+// Maintenance operations available from command line
+// for storages supporting them
+type migratableStorage interface {
+	PendingMigrations(ctx context.Context) ([]storage.Migration, error)
+}
+
+type tokenRotatingStorage interface {
+	RotateTokens(ctx context.Context) (int, error)
+}
+
+func openStorage(cfg *bot.Config, tokenCipher *storage.TokenCipher) (bot.Storage, error) {
+	switch cfg.StorageDriver {
+	case bot.DriverPostgres:
+		return postgres.New(cfg.GetPostgresConnectionString(), tokenCipher)
+	case bot.DriverSqlite:
+		return sqlite.New(cfg.DbName, tokenCipher)
+	case bot.DriverMemory:
+		return memory.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/bot"
+)
+
+const recomputeCmd = "recompute"
+
+// Rebuilds the user's report for the day from gitlab responses archived in the storage
+// and prints its rows. Stored versions of the report are left intact
+func recomputeReport(ctx context.Context, out io.Writer, store bot.Storage, userIdArg string, dateArg string) error {
+	userId, err := strconv.ParseInt(userIdArg, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad user id %q: %w", userIdArg, err)
+	}
+
+	user, err := store.User(ctx, userId)
+	if err != nil {
+		return fmt.Errorf("could not get user: %w", err)
+	}
+
+	day, err := time.ParseInLocation(time.DateOnly, dateArg, user.Location())
+	if err != nil {
+		return fmt.Errorf("bad report date %q: %w", dateArg, err)
+	}
+
+	recording, err := bot.ArchivedRecording(ctx, store, user, day)
+	if err != nil {
+		return err
+	}
+
+	return printRecomputed(ctx, out, recording)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/gitlab"
+	"github.com/BalanceBalls/report-generator/internal/report"
+)
+
+const replayCmd = "replay"
+
+// Workers of the replayed builder, responses are served from memory
+const replayWorkers = 4
+
+// Rebuilds the report from recorded gitlab responses and prints its rows.
+// Needs neither configuration nor database, so it runs anywhere the recording is copied to
+func replayRecording(ctx context.Context, out io.Writer, path string) error {
+	recording, err := gitlab.LoadRecording(path)
+	if err != nil {
+		return err
+	}
+
+	return printRecomputed(ctx, out, recording)
+}
+
+func printRecomputed(ctx context.Context, out io.Writer, recording gitlab.Recording) error {
+	zone := recording.User.Location()
+
+	fmt.Fprintf(out, "user %d, recorded at %s, period %s - %s\n\n",
+		recording.User.Id, recording.RecordedAt.Format(time.RFC3339),
+		recording.Period.Start.In(zone).Format(time.DateTime), recording.Period.End.In(zone).Format(time.DateTime))
+
+	result, err := gitlab.Recompute(ctx, recording, replayWorkers)
+	if errors.Is(err, gitlab.ErrNoGitActions) {
+		fmt.Fprintln(out, "no git actions to report")
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not rebuild report: %w", err)
+	}
+
+	return printReport(out, result, zone)
+}
+
+func printReport(out io.Writer, result report.Report, zone *time.Location) error {
+	table := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "DATE\tHOURS\tTASK\tSOURCE\tLINKS")
+	for _, row := range result.Rows {
+		fmt.Fprintf(table, "%s\t%.2f\t%s\t%s\t%s\n",
+			row.Date.In(zone).Format(time.DateTime), row.TimeSpent, row.Task, row.Source,
+			strings.ReplaceAll(row.Link, " \n ", ", "))
+	}
+
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	if len(result.Warnings) > 0 {
+		fmt.Fprintln(out)
+	}
+
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(out, "warning: %s of %q (%s): %s\n", warning.Kind, warning.Task, warning.Source, warning.Reason)
+	}
+
+	return nil
+}
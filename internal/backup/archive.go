@@ -0,0 +1,134 @@
+package backup
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/report"
+	"github.com/BalanceBalls/report-generator/internal/storage"
+)
+
+// Version of the archive layout, bumped on incompatible changes
+const FormatVersion = 1
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported backup format version")
+	ErrInvalidArchive    = errors.New("backup archive is invalid")
+)
+
+// Gzip compressed JSON document written to backup files
+type Archive struct {
+	FormatVersion int             `json:"formatVersion"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	Users         []report.User   `json:"users"`
+	Reports       []report.Report `json:"reports"`
+	// Missing in archives written before reports kept raw git data
+	ReportArchives []storage.ReportArchive `json:"reportArchives,omitempty"`
+}
+
+func WriteArchive(w io.Writer, snapshot storage.Snapshot, createdAt time.Time) error {
+	archive := Archive{
+		FormatVersion:  FormatVersion,
+		CreatedAt:      createdAt.UTC(),
+		Users:          snapshot.Users,
+		Reports:        snapshot.Reports,
+		ReportArchives: snapshot.Archives,
+	}
+
+	zw := gzip.NewWriter(w)
+	if err := json.NewEncoder(zw).Encode(archive); err != nil {
+		return fmt.Errorf("could not encode archive: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("could not compress archive: %w", err)
+	}
+
+	return nil
+}
+
+// Reads the archive and checks it can be restored
+func ReadArchive(r io.Reader) (Archive, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return Archive{}, fmt.Errorf("could not decompress archive: %w", err)
+	}
+	defer zr.Close()
+
+	var archive Archive
+	if err := json.NewDecoder(zr).Decode(&archive); err != nil {
+		return Archive{}, fmt.Errorf("could not decode archive: %w", err)
+	}
+
+	if err := archive.Validate(); err != nil {
+		return Archive{}, err
+	}
+
+	return archive, nil
+}
+
+// Checks the format version and that every record refers to existing ones
+func (a Archive) Validate() error {
+	if a.FormatVersion != FormatVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedFormat, a.FormatVersion)
+	}
+
+	users := make(map[int64]bool, len(a.Users))
+	accounts := make(map[int64]bool)
+	for _, user := range a.Users {
+		if users[user.Id] {
+			return fmt.Errorf("%w: user %d is duplicated", ErrInvalidArchive, user.Id)
+		}
+		users[user.Id] = true
+
+		for _, account := range user.Accounts {
+			if account.UserId != user.Id {
+				return fmt.Errorf("%w: account %d belongs to user %d, not %d",
+					ErrInvalidArchive, account.Id, account.UserId, user.Id)
+			}
+
+			if accounts[account.Id] {
+				return fmt.Errorf("%w: account %d is duplicated", ErrInvalidArchive, account.Id)
+			}
+			accounts[account.Id] = true
+		}
+	}
+
+	reports := make(map[int64]bool, len(a.Reports))
+	for _, r := range a.Reports {
+		if !users[r.UserId] {
+			return fmt.Errorf("%w: report %d belongs to unknown user %d", ErrInvalidArchive, r.Id, r.UserId)
+		}
+
+		if reports[r.Id] {
+			return fmt.Errorf("%w: report %d is duplicated", ErrInvalidArchive, r.Id)
+		}
+		reports[r.Id] = true
+	}
+
+	archives := make(map[int64]bool, len(a.ReportArchives))
+	for _, archive := range a.ReportArchives {
+		if !reports[archive.ReportId] {
+			return fmt.Errorf("%w: archive belongs to unknown report %d", ErrInvalidArchive, archive.ReportId)
+		}
+
+		if archives[archive.ReportId] {
+			return fmt.Errorf("%w: archive of report %d is duplicated", ErrInvalidArchive, archive.ReportId)
+		}
+		archives[archive.ReportId] = true
+	}
+
+	return nil
+}
+
+func (a Archive) Snapshot() storage.Snapshot {
+	return storage.Snapshot{
+		Users:    a.Users,
+		Reports:  a.Reports,
+		Archives: a.ReportArchives,
+	}
+}
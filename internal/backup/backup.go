@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/storage"
+)
+
+const (
+	filePrefix = "backup-"
+	fileSuffix = ".json.gz"
+	// Sorts in chronological order
+	fileTimeLayout = "20060102T150405Z"
+)
+
+// Storage able to export everything it keeps
+type Source interface {
+	Snapshot(ctx context.Context) (storage.Snapshot, error)
+}
+
+// Storage able to load an export into itself when empty
+type Target interface {
+	Restore(ctx context.Context, snapshot storage.Snapshot) error
+}
+
+// Writes backup archives of the storage to the directory
+// keeping only the given number of the latest ones
+type Manager struct {
+	source    Source
+	dir       string
+	retention int
+}
+
+func NewManager(source Source, dir string, retention int) *Manager {
+	return &Manager{
+		source:    source,
+		dir:       dir,
+		retention: retention,
+	}
+}
+
+// Writes a new archive and removes the outdated ones, returns path of the archive
+func (m *Manager) Backup(ctx context.Context) (string, error) {
+	snapshot, err := m.source.Snapshot(ctx)
+	if err != nil {
+		return "", fmt.Errorf("could not read storage: %w", err)
+	}
+
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return "", fmt.Errorf("could not create backup directory: %w", err)
+	}
+
+	createdAt := time.Now().UTC()
+	path := filepath.Join(m.dir, filePrefix+createdAt.Format(fileTimeLayout)+fileSuffix)
+
+	// Archive appears under its name only when it has been written completely
+	tmp, err := os.CreateTemp(m.dir, filePrefix+"*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("could not create backup file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := WriteArchive(tmp, snapshot, createdAt); err != nil {
+		tmp.Close()
+		return "", err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("could not write backup file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("could not save backup file: %w", err)
+	}
+
+	slog.InfoContext(ctx, "backup created",
+		"path", path, "users", len(snapshot.Users), "reports", len(snapshot.Reports))
+
+	if err := m.prune(); err != nil {
+		slog.WarnContext(ctx, "could not remove outdated backups", "reason", err)
+	}
+
+	return path, nil
+}
+
+// Makes backups with the interval until the context is done
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := m.Backup(ctx); err != nil {
+				slog.ErrorContext(ctx, "scheduled backup failed", "reason", err)
+			}
+		}
+	}
+}
+
+// Lists archives of the directory from the oldest to the latest
+func (m *Manager) Backups() ([]string, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+
+		result = append(result, filepath.Join(m.dir, name))
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+func (m *Manager) prune() error {
+	if m.retention <= 0 {
+		return nil
+	}
+
+	backups, err := m.Backups()
+	if err != nil {
+		return err
+	}
+
+	if len(backups) <= m.retention {
+		return nil
+	}
+
+	for _, outdated := range backups[:len(backups)-m.retention] {
+		if err := os.Remove(outdated); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validates the archive and loads it into the target storage, which must be empty
+func Restore(ctx context.Context, target Target, path string) (Archive, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Archive{}, fmt.Errorf("could not open backup file: %w", err)
+	}
+	defer file.Close()
+
+	archive, err := ReadArchive(file)
+	if err != nil {
+		return Archive{}, err
+	}
+
+	if err := target.Restore(ctx, archive.Snapshot()); err != nil {
+		return Archive{}, fmt.Errorf("could not restore backup: %w", err)
+	}
+
+	return archive, nil
+}
@@ -0,0 +1,197 @@
+package backup_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/backup"
+	"github.com/BalanceBalls/report-generator/internal/report"
+	"github.com/BalanceBalls/report-generator/internal/storage"
+	"github.com/BalanceBalls/report-generator/internal/storage/sqlite"
+	"github.com/BalanceBalls/report-generator/internal/storage/storagetest"
+)
+
+func newStorage(t *testing.T, cipher *storage.TokenCipher) *sqlite.SqliteStorage {
+	t.Helper()
+
+	s, err := sqlite.New(filepath.Join(t.TempDir(), "bot.sqlite"), cipher)
+	if err != nil {
+		t.Fatalf("sqlite.New() error = %v", err)
+	}
+
+	if err := s.Up(context.Background()); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	return s
+}
+
+func fillStorage(t *testing.T, s *sqlite.SqliteStorage) {
+	t.Helper()
+	ctx := context.Background()
+
+	user := report.User{Id: 1, GitlabId: 42, UserEmail: "user@example.com", UserToken: "glpat-user", IsActive: true}
+	if err := s.AddUser(ctx, user); err != nil {
+		t.Fatalf("AddUser() error = %v", err)
+	}
+
+	account := report.Account{UserId: 1, Provider: report.ProviderGitlab, Host: "gitlab.example.com", ExternalId: 7, Token: "glpat-account"}
+	if _, err := s.AddAccount(ctx, account); err != nil {
+		t.Fatalf("AddAccount() error = %v", err)
+	}
+
+	r := report.Report{
+		PeriodStart: time.Date(2023, 10, 5, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:   time.Date(2023, 10, 6, 0, 0, 0, 0, time.UTC),
+		Format:      "html",
+		Rows: []report.ReportRow{
+			{Date: time.Date(2023, 10, 5, 17, 48, 36, 0, time.UTC), Task: "tickets#2294", TimeSpent: 5.4},
+		},
+	}
+
+	// Two versions of the same period
+	for _, timeSpent := range []float32{5.4, 2} {
+		r.Rows[0].TimeSpent = timeSpent
+		if _, err := s.SaveReport(ctx, r, 1); err != nil {
+			t.Fatalf("SaveReport() error = %v", err)
+		}
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	ctx := context.Background()
+	cipher := storagetest.NewCipher(t)
+	source := newStorage(t, cipher)
+	fillStorage(t, source)
+
+	manager := backup.NewManager(source, t.TempDir(), 0)
+	path, err := manager.Backup(ctx)
+	if err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+
+	target := newStorage(t, cipher)
+	if _, err := backup.Restore(ctx, target, path); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	want, err := source.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	got, err := target.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("restored snapshot = %+v, want %+v", got, want)
+	}
+
+	// Restored tokens are readable with the same keys
+	user, err := target.User(ctx, 1)
+	if err != nil || user.UserToken != "glpat-user" {
+		t.Errorf("User() = %+v, %v, want token to be restored", user, err)
+	}
+
+	// New records continue after the restored ones
+	accountId, err := target.AddAccount(ctx, report.Account{UserId: 1, Provider: report.ProviderGitlab})
+	if err != nil || accountId != 2 {
+		t.Errorf("AddAccount() = %d, %v, want id 2", accountId, err)
+	}
+}
+
+func TestRestoreIntoNonEmptyStorage(t *testing.T) {
+	ctx := context.Background()
+	cipher := storagetest.NewCipher(t)
+	source := newStorage(t, cipher)
+	fillStorage(t, source)
+
+	path, err := backup.NewManager(source, t.TempDir(), 0).Backup(ctx)
+	if err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+
+	if _, err := backup.Restore(ctx, source, path); !errors.Is(err, storage.ErrNotEmpty) {
+		t.Errorf("Restore() error = %v, want %v", err, storage.ErrNotEmpty)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	old := []string{"backup-20231001T000000Z.json.gz", "backup-20231002T000000Z.json.gz", "backup-20231003T000000Z.json.gz"}
+	for _, name := range old {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatalf("could not create backup file: %v", err)
+		}
+	}
+
+	manager := backup.NewManager(newStorage(t, storagetest.NewCipher(t)), dir, 2)
+	latest, err := manager.Backup(context.Background())
+	if err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+
+	got, err := manager.Backups()
+	if err != nil {
+		t.Fatalf("Backups() error = %v", err)
+	}
+
+	want := []string{filepath.Join(dir, old[2]), latest}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Backups() = %v, want %v", got, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive backup.Archive
+		wantErr error
+	}{
+		{
+			name:    "unsupported version",
+			archive: backup.Archive{FormatVersion: backup.FormatVersion + 1},
+			wantErr: backup.ErrUnsupportedFormat,
+		},
+		{
+			name: "report of unknown user",
+			archive: backup.Archive{
+				FormatVersion: backup.FormatVersion,
+				Reports:       []report.Report{{Id: 1, UserId: 404}},
+			},
+			wantErr: backup.ErrInvalidArchive,
+		},
+		{
+			name: "duplicated user",
+			archive: backup.Archive{
+				FormatVersion: backup.FormatVersion,
+				Users:         []report.User{{Id: 1}, {Id: 1}},
+			},
+			wantErr: backup.ErrInvalidArchive,
+		},
+		{
+			name: "account of other user",
+			archive: backup.Archive{
+				FormatVersion: backup.FormatVersion,
+				Users:         []report.User{{Id: 1, Accounts: []report.Account{{Id: 1, UserId: 2}}}},
+			},
+			wantErr: backup.ErrInvalidArchive,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.archive.Validate(); !errors.Is(err, tc.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/gitlab"
+	"github.com/BalanceBalls/report-generator/internal/logger"
+	"github.com/BalanceBalls/report-generator/internal/report"
+	"github.com/BalanceBalls/report-generator/internal/storage"
+)
+
+// Returns gitlab responses archived with the latest version of the user's report for the day.
+// Versions generated before archiving was enabled are skipped
+func ArchivedRecording(ctx context.Context, store Storage, user report.User, day time.Time) (gitlab.Recording, error) {
+	period := report.UserDay(user, day)
+
+	versions, err := store.ReportVersions(ctx, user.Id, period.Start, period.End)
+	if err != nil {
+		return gitlab.Recording{}, fmt.Errorf("could not get report versions: %w", err)
+	}
+
+	for i := len(versions) - 1; i >= 0; i-- {
+		data, err := store.ReportArchive(ctx, user.Id, versions[i].Id)
+		if errors.Is(err, storage.ErrArchiveNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return gitlab.Recording{}, fmt.Errorf("could not get report archive: %w", err)
+		}
+
+		return gitlab.DecodeRecording(data)
+	}
+
+	return gitlab.Recording{}, storage.ErrArchiveNotFound
+}
+
+// Parses the date of the recompute command in the user's timezone
+func parseReportDate(input string, user report.User) (time.Time, error) {
+	return time.ParseInLocation(time.DateOnly, strings.TrimSpace(input), user.Location())
+}
+
+func (b *ReportsBot) saveArchive(ctx context.Context, reportId int64, recording gitlab.Recording) {
+	logger := logger.GetFromContext(ctx)
+
+	data, err := gitlab.EncodeRecording(recording)
+	if err != nil {
+		logger.ErrorContext(ctx, "could not encode report archive", "reason", err)
+		return
+	}
+
+	if err := b.storage.SaveReportArchive(ctx, reportId, data); err != nil {
+		logger.ErrorContext(ctx, "could not save report archive", "reason", err, "report_id", reportId)
+		return
+	}
+
+	logger.InfoContext(ctx, "report archive saved", "report_id", reportId, "size", len(data))
+}
+
+func (b *ReportsBot) handleRecompute(ctx context.Context, userId int64, chatId int64, args string) {
+	logger := logger.GetFromContext(ctx)
+	user, err := b.storage.User(ctx, userId)
+
+	if err != nil {
+		logger.ErrorContext(ctx, "report recompute failed", "reason", err)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			b.sendText(userNotRegisteredMsg, chatId)
+			return
+		}
+		b.sendText(reportGenerationFailedMsg, chatId)
+		return
+	}
+
+	day, err := parseReportDate(args, user)
+	if err != nil {
+		logger.WarnContext(ctx, "bad report date", "reason", err)
+		b.sendText(recomputeBadDateMsg, chatId)
+		return
+	}
+
+	recording, err := ArchivedRecording(ctx, b.storage, user, day)
+	if err != nil {
+		logger.ErrorContext(ctx, "could not load report archive", "reason", err)
+		if errors.Is(err, storage.ErrArchiveNotFound) {
+			b.sendText(recomputeNoArchiveMsg, chatId)
+			return
+		}
+		b.sendText(reportGenerationFailedMsg, chatId)
+		return
+	}
+
+	b.sendText(recomputeInProgressMsg, chatId)
+
+	result, err := gitlab.Recompute(ctx, recording, b.config.GitWorkers)
+	if errors.Is(err, gitlab.ErrNotRecorded) {
+		// Builder logic needs data the archive was made without
+		logger.ErrorContext(ctx, "report archive is incomplete", "reason", err)
+		b.sendText(recomputeOutdatedMsg, chatId)
+		return
+	}
+
+	caption := fmt.Sprintf(recomputedReportCaptionTemplate, day.Format(time.DateOnly))
+	b.processReportResult(ctx, result, err, chatId, userId, caption, &recording)
+}
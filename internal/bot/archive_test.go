@@ -0,0 +1,68 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/gitlab"
+	"github.com/BalanceBalls/report-generator/internal/report"
+	"github.com/BalanceBalls/report-generator/internal/storage"
+	"github.com/BalanceBalls/report-generator/internal/storage/memory"
+)
+
+func TestArchivedRecording(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+
+	user := report.User{Id: 1, TimezoneOffset: 300}
+	if err := store.AddUser(ctx, user); err != nil {
+		t.Fatalf("AddUser() error = %v", err)
+	}
+
+	day := time.Date(2023, 10, 5, 0, 0, 0, 0, user.Location())
+	period := report.UserDay(user, day)
+
+	if _, err := ArchivedRecording(ctx, store, user, day); !errors.Is(err, storage.ErrArchiveNotFound) {
+		t.Fatalf("ArchivedRecording() error = %v, want %v", err, storage.ErrArchiveNotFound)
+	}
+
+	// The latest version generated without an archive is skipped
+	for i, baseUrl := range []string{"https://first.example.com", "https://second.example.com", empty} {
+		saved, err := store.SaveReport(ctx, report.Report{
+			PeriodStart: period.Start,
+			PeriodEnd:   period.End,
+			Rows:        []report.ReportRow{{Date: period.Start, Task: "TASK-1", TimeSpent: float32(i + 1)}},
+		}, user.Id)
+		if err != nil {
+			t.Fatalf("SaveReport() error = %v", err)
+		}
+
+		if baseUrl == empty {
+			continue
+		}
+
+		data, err := gitlab.EncodeRecording(gitlab.Recording{
+			FormatVersion: gitlab.RecordingFormatVersion,
+			BaseUrl:       baseUrl,
+			Period:        period,
+		})
+		if err != nil {
+			t.Fatalf("EncodeRecording() error = %v", err)
+		}
+
+		if err := store.SaveReportArchive(ctx, saved.Id, data); err != nil {
+			t.Fatalf("SaveReportArchive() error = %v", err)
+		}
+	}
+
+	recording, err := ArchivedRecording(ctx, store, user, day.Add(20*time.Hour))
+	if err != nil {
+		t.Fatalf("ArchivedRecording() error = %v", err)
+	}
+
+	if recording.BaseUrl != "https://second.example.com" {
+		t.Errorf("ArchivedRecording() base url = %q, want the archive of the latest archived version", recording.BaseUrl)
+	}
+}
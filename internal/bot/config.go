@@ -1,8 +1,51 @@
 package bot
 
-import "fmt"
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// Supported storage drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSqlite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
+// Ways to receive telegram updates
+const (
+	UpdatesModePolling = "polling"
+	UpdatesModeWebhook = "webhook"
+)
+
+// Log outputs
+const (
+	LogOutputFile   = "file"
+	LogOutputStdout = "stdout"
+	LogOutputBoth   = "both"
+)
 
 type Config struct {
+	// Address of health, readiness and metrics endpoints, disabled when empty
+	HttpAddr string `env:"HTTP_ADDR" envDefault:":8080"`
+
+	LogLevel  string `env:"LOG_LEVEL" envDefault:"info"`
+	LogOutput string `env:"LOG_OUTPUT" envDefault:"file"`
+	LogFile   string `env:"LOG_FILE" envDefault:"bot.log"`
+	// Log file is rotated when it exceeds the size or gets older than the interval,
+	// zero disables the corresponding rotation
+	LogMaxSizeMb      int           `env:"LOG_MAX_SIZE_MB" envDefault:"50"`
+	LogRotateInterval time.Duration `env:"LOG_ROTATE_INTERVAL" envDefault:"24h"`
+	// Number of rotated log files to keep, all of them are kept when zero
+	LogRetention int `env:"LOG_RETENTION" envDefault:"14"`
+
+	StorageDriver string `env:"STORAGE_DRIVER" envDefault:"postgres"`
+
 	DbName string `env:"DB_NAME" envDefault:"bot.sqlite"`
 
 	PgPass string `env:"PG_PASS" envDefault:"admin"`
@@ -10,17 +53,122 @@ type Config struct {
 	PgDb   string `env:"PG_DB" envDefault:"bot"`
 	PgHost string `env:"PG_HOST" envDefault:"tg_bot_db"`
 
+	// Keys used to encrypt stored tokens, formatted as 'id:base64_key,...'
+	TokenKeys string `env:"TOKEN_KEYS,notEmpty"`
+	// Id of the key new values are encrypted with
+	TokenKeyId int `env:"TOKEN_KEY_ID" envDefault:"1"`
+
 	ReportFileDir  string `env:"REPORT_FILE_DIR" envDefault:"./reports"`
 	ReportTemplate string `env:"REPORT_TEMPLATE" envDefault:"html_report.tmpl"`
 	GenerateFile   bool   `env:"GENERATE_FILE" envDefault:"false"`
+	// Gitlab responses are stored with every report so it can be recomputed later
+	ReportArchive bool `env:"REPORT_ARCHIVE" envDefault:"true"`
+
+	UpdatesMode string `env:"UPDATES_MODE" envDefault:"polling"`
+	// Public url telegram sends updates to, e.g. https://bot.example.com/telegram/webhook
+	WebhookUrl        string `env:"WEBHOOK_URL"`
+	WebhookListenAddr string `env:"WEBHOOK_LISTEN_ADDR" envDefault:":8443"`
+	WebhookPath       string `env:"WEBHOOK_PATH" envDefault:"/telegram/webhook"`
+	// Sent by telegram with every update to prove the request is genuine
+	WebhookSecret string `env:"WEBHOOK_SECRET"`
+	// Webhook is served over plain HTTP when not set, e.g. behind TLS terminating ingress
+	WebhookTlsCert string `env:"WEBHOOK_TLS_CERT"`
+	WebhookTlsKey  string `env:"WEBHOOK_TLS_KEY"`
 
 	BotToken        string `env:"BOT_TOKEN,notEmpty"`
 	CommandsTimeout int    `env:"COMMANDS_TIMEOUT" envDefault:"30"`
+	// Time given to commands being processed to finish on shutdown
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"30s"`
+	// Days before gitlab token expiration to start warning users
+	TokenExpiryWarnDays int `env:"TOKEN_EXPIRY_WARN_DAYS" envDefault:"7"`
 
+	// Full API url, e.g. http://gitlab.staging:8080/api/v4. Built of GitHost and GitBasePath when not set
+	GitBaseUrl  string `env:"GIT_BASE_URL"`
 	GitHost     string `env:"GIT_HOST" envDefault:"localhost:4443"`
 	GitBasePath string `env:"GIT_BASE_PATH" envDefault:"api/v4"`
+	// PEM bundle of private CAs trusted in addition to the system ones
+	GitCaFile string `env:"GIT_CA_FILE"`
+	// Client certificate for gitlab instances requiring mTLS
+	GitClientCert string `env:"GIT_CLIENT_CERT"`
+	GitClientKey  string `env:"GIT_CLIENT_KEY"`
+	// HTTP_PROXY and HTTPS_PROXY are used when not set
+	GitProxy string `env:"GIT_PROXY"`
+	// Timeout of a single request attempt, retries are not included
+	GitRequestTimeout      time.Duration `env:"GIT_REQUEST_TIMEOUT" envDefault:"30s"`
+	GitDialTimeout         time.Duration `env:"GIT_DIAL_TIMEOUT" envDefault:"10s"`
+	GitIdleConnTimeout     time.Duration `env:"GIT_IDLE_CONN_TIMEOUT" envDefault:"90s"`
+	GitMaxIdleConns        int           `env:"GIT_MAX_IDLE_CONNS" envDefault:"100"`
+	GitMaxIdleConnsPerHost int           `env:"GIT_MAX_IDLE_CONNS_PER_HOST" envDefault:"10"`
+	// Unlimited when zero
+	GitMaxConnsPerHost int `env:"GIT_MAX_CONNS_PER_HOST" envDefault:"0"`
+	// Concurrent requests to gitlab made while building a report
+	GitWorkers int `env:"GIT_WORKERS" envDefault:"8"`
+	// Merge requests and commits kept in memory, caching is disabled when zero
+	GitCacheSize int `env:"GIT_CACHE_SIZE" envDefault:"1000"`
+	// Merge requests are revalidated with gitlab when cached longer
+	GitCacheTtl time.Duration `env:"GIT_CACHE_TTL" envDefault:"1h"`
+	// Keeps cached responses in the database between restarts
+	GitCachePersist bool `env:"GIT_CACHE_PERSIST" envDefault:"false"`
+	// Gitlab responses of every report generation are recorded to the directory when set
+	GitRecordDir string `env:"GIT_RECORD_DIR"`
+	// Hosts users are permitted to use in addition to the default one
+	GitAllowedHosts []string `env:"GIT_ALLOWED_HOSTS" envSeparator:","`
+	// Requests per second to every gitlab host shared by all users, unlimited when zero
+	GitRateLimit float64 `env:"GIT_RATE_LIMIT" envDefault:"10"`
+	GitRateBurst int     `env:"GIT_RATE_BURST" envDefault:"10"`
+	// Attempts of a request failed with a temporary error, including the first one
+	GitMaxAttempts    int           `env:"GIT_MAX_ATTEMPTS" envDefault:"4"`
+	GitRetryBaseDelay time.Duration `env:"GIT_RETRY_BASE_DELAY" envDefault:"500ms"`
+	// Requests are not retried when gitlab asks to wait longer
+	GitRetryMaxDelay time.Duration `env:"GIT_RETRY_MAX_DELAY" envDefault:"10s"`
+
+	// Telegram ids of users permitted to run admin commands
+	AdminIds []int64 `env:"ADMIN_IDS" envSeparator:","`
+
+	BackupDir string `env:"BACKUP_DIR" envDefault:"./backups"`
+	// Scheduled backups are disabled when zero
+	BackupInterval time.Duration `env:"BACKUP_INTERVAL" envDefault:"24h"`
+	// Number of the latest backups to keep, all of them are kept when zero
+	BackupRetention int `env:"BACKUP_RETENTION" envDefault:"7"`
 }
 
 func (c *Config) GetPostgresConnectionString() string {
 	return fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", c.PgUser, c.PgPass, c.PgHost, c.PgDb)
 }
+
+// Url of gitlab API used when users have not set their own host
+func (c *Config) GitlabBaseUrl() string {
+	if c.GitBaseUrl != "" {
+		return c.GitBaseUrl
+	}
+
+	return "https://" + path.Join(c.GitHost, c.GitBasePath)
+}
+
+// Host of the default gitlab instance
+func (c *Config) GitlabHost() string {
+	if u, err := url.Parse(c.GitlabBaseUrl()); err == nil && u.Host != "" {
+		return u.Host
+	}
+
+	return c.GitHost
+}
+
+// Checks whether users are permitted to fetch git actions from the host
+func (c *Config) IsGitHostAllowed(host string) bool {
+	if strings.EqualFold(host, c.GitlabHost()) {
+		return true
+	}
+
+	for _, allowed := range c.GitAllowedHosts {
+		if strings.EqualFold(host, strings.TrimSpace(allowed)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Config) IsAdmin(userId int64) bool {
+	return slices.Contains(c.AdminIds, userId)
+}
@@ -2,7 +2,9 @@ package bot
 
 import (
 	"context"
+	"time"
 
+	"github.com/BalanceBalls/report-generator/internal/gitlab"
 	"github.com/BalanceBalls/report-generator/internal/report"
 )
 
@@ -12,14 +14,32 @@ type Storage interface {
 	UserExists(ctx context.Context, userId int64) bool
 	UpdateUser(ctx context.Context, user report.User) error
 	RemoveUser(ctx context.Context, userId int64) error
-	SaveReport(ctx context.Context, report report.Report, userId int64) error
+	Accounts(ctx context.Context, userId int64) ([]report.Account, error)
+	AddAccount(ctx context.Context, account report.Account) (int64, error)
+	RemoveAccount(ctx context.Context, userId int64, accountId int64) error
+	SaveReport(ctx context.Context, report report.Report, userId int64) (report.Report, error)
+	Reports(ctx context.Context, userId int64) ([]report.Report, error)
+	ReportVersions(ctx context.Context, userId int64, periodStart time.Time, periodEnd time.Time) ([]report.Report, error)
+	SaveReportArchive(ctx context.Context, reportId int64, data []byte) error
+	ReportArchive(ctx context.Context, userId int64, reportId int64) ([]byte, error)
 	Up(ctx context.Context) error
+	Ping(ctx context.Context) error
 }
 
 type Builder interface {
-	Build(ctx context.Context, user report.User, respch chan report.Channel)
+	Build(ctx context.Context, user report.User, period report.Period) (report.Report, error)
+}
+
+type GitClient interface {
+	CurrentUser(ctx context.Context, account report.Account) (*gitlab.User, error)
+	TokenInfo(ctx context.Context, account report.Account) (*gitlab.PersonalAccessToken, error)
+}
+
+type Backuper interface {
+	Backup(ctx context.Context) (string, error)
 }
 
 type Generator interface {
 	Generate(report report.Report) (report.Result, error)
+	Format() string
 }
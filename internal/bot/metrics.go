@@ -0,0 +1,110 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/metrics"
+	"github.com/BalanceBalls/report-generator/internal/report"
+	"github.com/BalanceBalls/report-generator/internal/storage"
+)
+
+// Storage counting failed operations.
+// Missing users and accounts are expected outcomes rather than failures
+type measuredStorage struct {
+	Storage
+}
+
+func withMetrics(store Storage) Storage {
+	return measuredStorage{Storage: store}
+}
+
+func countError(operation string, err error) {
+	if err == nil || errors.Is(err, storage.ErrUserNotFound) || errors.Is(err, storage.ErrAccountNotFound) ||
+		errors.Is(err, storage.ErrArchiveNotFound) {
+		return
+	}
+
+	metrics.StorageErrors.Inc(operation)
+}
+
+func (s measuredStorage) User(ctx context.Context, userId int64) (report.User, error) {
+	user, err := s.Storage.User(ctx, userId)
+	countError("user", err)
+	return user, err
+}
+
+func (s measuredStorage) AddUser(ctx context.Context, user report.User) error {
+	err := s.Storage.AddUser(ctx, user)
+	countError("add_user", err)
+	return err
+}
+
+func (s measuredStorage) UpdateUser(ctx context.Context, user report.User) error {
+	err := s.Storage.UpdateUser(ctx, user)
+	countError("update_user", err)
+	return err
+}
+
+func (s measuredStorage) RemoveUser(ctx context.Context, userId int64) error {
+	err := s.Storage.RemoveUser(ctx, userId)
+	countError("remove_user", err)
+	return err
+}
+
+func (s measuredStorage) Accounts(ctx context.Context, userId int64) ([]report.Account, error) {
+	accounts, err := s.Storage.Accounts(ctx, userId)
+	countError("accounts", err)
+	return accounts, err
+}
+
+func (s measuredStorage) AddAccount(ctx context.Context, account report.Account) (int64, error) {
+	id, err := s.Storage.AddAccount(ctx, account)
+	countError("add_account", err)
+	return id, err
+}
+
+func (s measuredStorage) RemoveAccount(ctx context.Context, userId int64, accountId int64) error {
+	err := s.Storage.RemoveAccount(ctx, userId, accountId)
+	countError("remove_account", err)
+	return err
+}
+
+func (s measuredStorage) SaveReport(ctx context.Context, r report.Report, userId int64) (report.Report, error) {
+	saved, err := s.Storage.SaveReport(ctx, r, userId)
+	countError("save_report", err)
+	return saved, err
+}
+
+func (s measuredStorage) Reports(ctx context.Context, userId int64) ([]report.Report, error) {
+	reports, err := s.Storage.Reports(ctx, userId)
+	countError("reports", err)
+	return reports, err
+}
+
+func (s measuredStorage) ReportVersions(
+	ctx context.Context, userId int64, periodStart time.Time, periodEnd time.Time,
+) ([]report.Report, error) {
+	reports, err := s.Storage.ReportVersions(ctx, userId, periodStart, periodEnd)
+	countError("report_versions", err)
+	return reports, err
+}
+
+func (s measuredStorage) SaveReportArchive(ctx context.Context, reportId int64, data []byte) error {
+	err := s.Storage.SaveReportArchive(ctx, reportId, data)
+	countError("save_report_archive", err)
+	return err
+}
+
+func (s measuredStorage) ReportArchive(ctx context.Context, userId int64, reportId int64) ([]byte, error) {
+	data, err := s.Storage.ReportArchive(ctx, userId, reportId)
+	countError("report_archive", err)
+	return data, err
+}
+
+func (s measuredStorage) Ping(ctx context.Context) error {
+	err := s.Storage.Ping(ctx)
+	countError("ping", err)
+	return err
+}
@@ -6,18 +6,22 @@ import (
 	"fmt"
 	"log/slog"
 	"math"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	htmlgenerator "github.com/BalanceBalls/report-generator/internal/generator/html"
 	"github.com/BalanceBalls/report-generator/internal/gitlab"
 	"github.com/BalanceBalls/report-generator/internal/logger"
+	"github.com/BalanceBalls/report-generator/internal/metrics"
 	"github.com/BalanceBalls/report-generator/internal/report"
+	"github.com/BalanceBalls/report-generator/internal/server"
 	"github.com/BalanceBalls/report-generator/internal/storage"
-	"github.com/BalanceBalls/report-generator/internal/storage/postgres"
 
 	tg "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"golang.org/x/exp/slices"
 )
 
 type ReportsBot struct {
@@ -27,18 +31,46 @@ type ReportsBot struct {
 	storage   Storage
 	builder   Builder
 	generator Generator
+	gitClient GitClient
+	// Nil when the storage does not support backups
+	backups Backuper
+
+	// Updates being processed, waited for on shutdown
+	handlers sync.WaitGroup
 }
 
 const empty = ""
 
+// Time given to cancelled updates to return after the shutdown timeout
+const cancelledHandlersTimeout = 5 * time.Second
+
 // commands
 const (
-	helpCmd    = "help"
-	regCmd     = "reg"
-	unregCmd   = "unreg"
-	genDayCmd  = "gen_day"
-	startCmd   = "start"
-	profileCmd = "profile"
+	helpCmd      = "help"
+	regCmd       = "reg"
+	unregCmd     = "unreg"
+	genDayCmd    = "gen_day"
+	startCmd     = "start"
+	profileCmd   = "profile"
+	accountsCmd  = "accounts"
+	recomputeCmd = "recompute"
+)
+
+// admin commands
+const (
+	backupCmd = "backup"
+)
+
+var knownCommands = []string{
+	helpCmd, regCmd, unregCmd, genDayCmd, startCmd, profileCmd, accountsCmd, recomputeCmd, backupCmd,
+}
+
+// report generation results
+const (
+	generationSucceeded = "success"
+	generationEmpty     = "empty"
+	generationFailed    = "error"
+	generationTimeout   = "timeout"
 )
 
 // user input prefixes
@@ -46,34 +78,79 @@ const (
 	setTokenPrefix    = "token:"
 	setOffsetPrefix   = "offset:"
 	setGitlabIdPrefix = "id:"
+	setHostPrefix     = "host:"
+	linkAccountPrefix = "account:"
+	unlinkPrefix      = "unlink:"
 )
 
-func New(cfg *Config) *ReportsBot {
+// Token scopes sufficient to read user's git actions
+var requiredTokenScopes = []string{"read_api", "api"}
+
+func New(cfg *Config, store Storage, backups Backuper) *ReportsBot {
 	bot, err := tg.NewBotAPI(cfg.BotToken)
 	if err != nil {
 		panic(err)
 	}
 
-	pgConnString := cfg.GetPostgresConnectionString()
-	pgSql, err := postgres.New(pgConnString)
+	html := htmlgenerator.New(cfg.ReportFileDir, cfg.ReportTemplate, cfg.GenerateFile)
+	gitlabClient, err := gitlab.NewClient(gitlab.ClientConfig{
+		BaseUrl:             cfg.GitlabBaseUrl(),
+		CaFile:              cfg.GitCaFile,
+		ClientCertFile:      cfg.GitClientCert,
+		ClientKeyFile:       cfg.GitClientKey,
+		ProxyUrl:            cfg.GitProxy,
+		RequestTimeout:      cfg.GitRequestTimeout,
+		DialTimeout:         cfg.GitDialTimeout,
+		IdleConnTimeout:     cfg.GitIdleConnTimeout,
+		MaxIdleConns:        cfg.GitMaxIdleConns,
+		MaxIdleConnsPerHost: cfg.GitMaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.GitMaxConnsPerHost,
+		Retry: gitlab.RetryPolicy{
+			MaxAttempts: cfg.GitMaxAttempts,
+			BaseDelay:   cfg.GitRetryBaseDelay,
+			MaxDelay:    cfg.GitRetryMaxDelay,
+		},
+		RateLimit: cfg.GitRateLimit,
+		RateBurst: cfg.GitRateBurst,
+		Cache:     newGitlabCache(cfg, store),
+	})
 	if err != nil {
 		panic(err)
 	}
-
-	html := htmlgenerator.New(cfg.ReportFileDir, cfg.ReportTemplate, cfg.GenerateFile)
-	gitlabClient := gitlab.NewClient(cfg.GitHost, cfg.GitBasePath)
-	reportBuilder := gitlab.NewReportBuilder(*gitlabClient)
+	reportBuilder := gitlab.NewReportBuilder(*gitlabClient, cfg.GitWorkers)
 
 	return &ReportsBot{
 		Bot: *bot,
 
 		config:    cfg,
-		storage:   pgSql,
+		storage:   withMetrics(store),
 		generator: html,
 		builder:   reportBuilder,
+		gitClient: gitlabClient,
+		backups:   backups,
 	}
 }
 
+// Cached responses are persisted only by storages supporting it
+func newGitlabCache(cfg *Config, store Storage) *gitlab.Cache {
+	if cfg.GitCacheSize <= 0 {
+		return nil
+	}
+
+	var persistent gitlab.CacheStore
+	if cfg.GitCachePersist {
+		cacheStore, ok := store.(gitlab.CacheStore)
+		if ok {
+			persistent = cacheStore
+		} else {
+			slog.Warn("storage does not support persisting gitlab cache, responses are kept in memory only",
+				"driver", cfg.StorageDriver)
+		}
+	}
+
+	return gitlab.NewCache(cfg.GitCacheSize, cfg.GitCacheTtl, persistent)
+}
+
 func (b *ReportsBot) Serve(ctx context.Context) {
 	slog.Info("bot authorized to telegram", "user", b.Bot.Self.UserName)
 
@@ -81,32 +158,149 @@ func (b *ReportsBot) Serve(ctx context.Context) {
 		slog.ErrorContext(ctx, err.Error())
 		panic(err)
 	}
-	updateConfig := tg.NewUpdate(0)
-	updateConfig.Timeout = b.config.CommandsTimeout
-	updates := b.Bot.GetUpdatesChan(updateConfig)
+
+	var updates tg.UpdatesChannel
+	var stopUpdates func()
+	var err error
+
+	switch b.config.UpdatesMode {
+	case UpdatesModePolling:
+		updates, stopUpdates, err = b.startPolling(ctx)
+	case UpdatesModeWebhook:
+		updates, stopUpdates, err = b.startWebhook(ctx)
+	default:
+		err = fmt.Errorf("unknown updates mode %q", b.config.UpdatesMode)
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "could not start receiving updates", "reason", err, "mode", b.config.UpdatesMode)
+		panic(err)
+	}
+
+	// Updates being processed are not cancelled with the context,
+	// they are given time to finish on shutdown instead
+	handlersCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
 
 	slog.Info("bot is now ready to serve commands")
 
-	for update := range updates {
-		// ignore any non-Message updates
-		if update.Message == nil {
-			continue
+	for {
+		select {
+		case <-ctx.Done():
+			b.shutdown(handlersCtx, updates, stopUpdates, cancelHandlers)
+			return
+		case update := <-updates:
+			b.dispatch(handlersCtx, update)
 		}
+	}
+}
+
+// Processes the update in background
+func (b *ReportsBot) dispatch(ctx context.Context, update tg.Update) {
+	// ignore any non-Message updates
+	if update.Message == nil {
+		return
+	}
+
+	b.handlers.Add(1)
+	go func(update tg.Update) {
+		defer b.handlers.Done()
+		b.processUpdate(ctx, update)
+	}(update)
+}
+
+// Stops receiving updates and waits for the ones being processed.
+// Handlers still running after the shutdown timeout are cancelled and given a short time to return
+func (b *ReportsBot) shutdown(
+	handlersCtx context.Context, updates tg.UpdatesChannel, stopUpdates func(), cancelHandlers context.CancelFunc,
+) {
+	slog.Info("bot is shutting down, no more updates are received")
+
+	stopped := make(chan struct{})
+	go func() {
+		stopUpdates()
+		close(stopped)
+	}()
+
+	// Updates received until now have been acknowledged to telegram already,
+	// so they are processed instead of being lost. Webhook requests
+	// waiting for the buffer are served while the server shuts down
+	for waiting := true; waiting; {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				// Only the stop is waited for
+				updates = nil
+				continue
+			}
+			b.dispatch(handlersCtx, update)
+		case <-stopped:
+			waiting = false
+		}
+	}
+
+	for len(updates) > 0 {
+		b.dispatch(handlersCtx, <-updates)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		b.handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("all updates have been processed")
+	case <-time.After(b.config.ShutdownTimeout):
+		slog.Warn("shutdown timeout exceeded, cancelling updates being processed")
+		cancelHandlers()
+	}
 
-		go b.processUpdate(ctx, update)
+	// Storage is closed once the bot stops, cancelled handlers must not use it anymore
+	select {
+	case <-done:
+	case <-time.After(cancelledHandlersTimeout):
+		slog.Error("updates being processed did not stop after cancellation")
+	}
+}
+
+// Readiness checks of the bot dependencies
+func (b *ReportsBot) Checks() []server.Check {
+	return []server.Check{
+		{Name: "storage", Check: b.storage.Ping},
+		{Name: "telegram", Check: func(ctx context.Context) error {
+			_, err := b.Bot.GetMe()
+			return err
+		}},
 	}
 }
 
+// Unknown commands share a single label to keep metrics cardinality bounded
+func commandLabel(command string) string {
+	if slices.Contains(knownCommands, command) {
+		return command
+	}
+
+	return "unknown"
+}
+
 func (b *ReportsBot) processUpdate(ctx context.Context, update tg.Update) {
 	updateCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(b.config.CommandsTimeout))
 	defer cancel()
 
+	// Secrets must not end up in logs
+	loggedText := update.Message.Text
+	if hasSecret(loggedText) {
+		loggedText = maskSecretInput(loggedText)
+	}
+
 	commandLogger := slog.With(
 		slog.Group("context",
 			slog.Int("trace_id", update.UpdateID),
 			slog.Int64("tg_chat_id", update.Message.Chat.ID),
 			slog.Int64("tg_user_id", update.Message.From.ID),
-			slog.String("text", update.Message.Text),
+			slog.String("text", loggedText),
 		))
 	updateCtx = logger.AttachToContext(updateCtx, commandLogger)
 
@@ -116,6 +310,19 @@ func (b *ReportsBot) processUpdate(ctx context.Context, update tg.Update) {
 		chatId := update.Message.Chat.ID
 
 		userInput := update.Message.Text
+
+		// Messages with secrets are removed from chat history whatever
+		// the outcome is. Group chats are not trusted to receive them at all
+		if hasSecret(userInput) {
+			defer b.deleteMessage(updateCtx, chatId, update.Message.MessageID)
+
+			if !update.Message.Chat.IsPrivate() {
+				commandLogger.WarnContext(updateCtx, "secret received in non private chat")
+				b.sendText(secretInGroupChatMsg, chatId)
+				return
+			}
+		}
+
 		dbUser, err := b.storage.User(updateCtx, userId)
 
 		if err != nil {
@@ -135,6 +342,15 @@ func (b *ReportsBot) processUpdate(ctx context.Context, update tg.Update) {
 		} else if strings.HasPrefix(userInput, setGitlabIdPrefix) {
 			b.setUserGitlabId(updateCtx, userInput, chatId, dbUser)
 			return
+		} else if strings.HasPrefix(userInput, setHostPrefix) {
+			b.setUserGitlabHost(updateCtx, userInput, chatId, dbUser)
+			return
+		} else if strings.HasPrefix(userInput, linkAccountPrefix) {
+			b.linkAccount(updateCtx, userInput, chatId, dbUser)
+			return
+		} else if strings.HasPrefix(userInput, unlinkPrefix) {
+			b.unlinkAccount(updateCtx, userInput, chatId, dbUser)
+			return
 		} else {
 			commandLogger.WarnContext(updateCtx, "user input was not recognized", "input", userInput)
 		}
@@ -146,7 +362,10 @@ func (b *ReportsBot) processUpdate(ctx context.Context, update tg.Update) {
 	userId := update.Message.From.ID
 
 	// Extract the command from the Message.
-	switch update.Message.Command() {
+	command := update.Message.Command()
+	metrics.Commands.Inc(commandLabel(command))
+
+	switch command {
 	case startCmd:
 		commandLogger.InfoContext(updateCtx, "/start cmd received")
 		b.sendText(helloMsg, chatId)
@@ -165,6 +384,19 @@ func (b *ReportsBot) processUpdate(ctx context.Context, update tg.Update) {
 	case profileCmd:
 		commandLogger.InfoContext(updateCtx, "/profile cmd received")
 		b.handleProfileInfo(updateCtx, userId, chatId)
+	case accountsCmd:
+		commandLogger.InfoContext(updateCtx, "/accounts cmd received")
+		b.handleAccountsInfo(updateCtx, userId, chatId)
+	case recomputeCmd:
+		commandLogger.InfoContext(updateCtx, "/recompute cmd received")
+		b.handleRecompute(updateCtx, userId, chatId, update.Message.CommandArguments())
+	case backupCmd:
+		if !b.config.IsAdmin(userId) {
+			commandLogger.WarnContext(updateCtx, "admin command received from non admin user")
+			return
+		}
+		commandLogger.InfoContext(updateCtx, "/backup cmd received")
+		b.handleBackup(updateCtx, chatId)
 	default:
 		commandLogger.WarnContext(updateCtx, "command was not recognized")
 	}
@@ -184,53 +416,124 @@ func (b *ReportsBot) handleReportGeneration(ctx context.Context, userId int64, c
 		return
 	}
 
-	if user.GitlabId == 0 {
-		logger.ErrorContext(ctx, "gitlab id is not set for user")
-		b.sendText(gitlabIdNotSetErrorMsg, chatId)
+	user.Accounts, err = b.storage.Accounts(ctx, userId)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to get linked accounts", "reason", err)
+		b.sendText(reportGenerationFailedMsg, chatId)
 		return
 	}
 
-	if user.UserToken == empty {
-		logger.ErrorContext(ctx, "user token is not set for user")
-		b.sendText(tokenNotSetErrorMsg, chatId)
-		return
+	// Linked accounts are enough to build a report
+	// even if the primary one is not configured
+	if len(user.Accounts) == 0 {
+		if user.GitlabId == 0 {
+			logger.ErrorContext(ctx, "gitlab id is not set for user")
+			b.sendText(gitlabIdNotSetErrorMsg, chatId)
+			return
+		}
+
+		if user.UserToken == empty {
+			logger.ErrorContext(ctx, "user token is not set for user")
+			b.sendText(tokenNotSetErrorMsg, chatId)
+			return
+		}
 	}
 
 	b.sendText(reportInProgressMsg, chatId)
 
-	respch := make(chan report.Channel)
-	go b.builder.Build(ctx, user, respch)
+	period := report.UserDay(user, time.Now())
 
-	select {
-	case <-ctx.Done():
-		logger.ErrorContext(ctx, "update cancelled", "reason", ctx.Err())
-	case reportData := <-respch:
-		b.processReportResult(ctx, reportData, chatId, user.Id)
+	var recorder *gitlab.Recorder
+	if b.config.GitRecordDir != empty || b.config.ReportArchive {
+		recorder = gitlab.NewRecorder()
+		ctx = gitlab.WithRecorder(ctx, recorder)
 	}
+
+	result, err := b.builder.Build(ctx, user, period)
+
+	var archive *gitlab.Recording
+	if recorder != nil {
+		recording := recorder.Recording(b.config.GitlabBaseUrl(), user, period)
+		if b.config.GitRecordDir != empty {
+			b.saveRecording(ctx, recording)
+		}
+		if b.config.ReportArchive {
+			archive = &recording
+		}
+	}
+
+	b.processReportResult(ctx, result, err, chatId, user.Id, reportFileCaption, archive)
+}
+
+// Recordings let wrong reports be rebuilt offline with the replay command
+func (b *ReportsBot) saveRecording(ctx context.Context, recording gitlab.Recording) {
+	logger := logger.GetFromContext(ctx)
+
+	name := fmt.Sprintf("recording-%d-%s.json", recording.User.Id, recording.RecordedAt.Format("20060102T150405Z"))
+	path := filepath.Join(b.config.GitRecordDir, name)
+
+	if err := gitlab.WriteRecording(path, recording); err != nil {
+		logger.ErrorContext(ctx, "could not save gitlab recording", "reason", err)
+		return
+	}
+
+	logger.InfoContext(ctx, "gitlab responses recorded", "path", path, "exchanges", len(recording.Exchanges))
 }
 
-func (b *ReportsBot) processReportResult(ctx context.Context, reportData report.Channel, chatId int64, userId int64) {
+// Saves and sends the built report. The archive, when given, is stored with the saved version
+func (b *ReportsBot) processReportResult(
+	ctx context.Context, result report.Report, err error, chatId int64, userId int64,
+	caption string, archive *gitlab.Recording,
+) {
 	logger := logger.GetFromContext(ctx)
 
-	if reportData.Err != nil {
-		logger.ErrorContext(ctx, "failed to get report data", "reason", reportData.Err)
-		if errors.Is(reportData.Err, gitlab.ErrNoGitActions) {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		metrics.ReportGenerations.Inc(generationTimeout)
+		logger.ErrorContext(ctx, "update cancelled", "reason", ctxErr)
+		return
+	}
+
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to get report data", "reason", err)
+		if errors.Is(err, gitlab.ErrNoGitActions) {
+			metrics.ReportGenerations.Inc(generationEmpty)
 			b.sendText(emptyReportMsg, chatId)
 			return
 		}
-		b.sendText(reportGenerationFailedMsg, chatId)
+		metrics.ReportGenerations.Inc(generationFailed)
+		b.sendText(gitlabErrorMsg(err, reportGenerationFailedMsg), chatId)
 		return
 	}
 
-	if err := b.storage.SaveReport(ctx, reportData.Report, userId); err != nil {
+	for _, warning := range result.Warnings {
+		logger.WarnContext(ctx, "report is incomplete",
+			"kind", warning.Kind, "source", warning.Source, "task", warning.Task, "reason", warning.Reason)
+	}
+
+	warnings := result.Warnings
+	result.Format = b.generator.Format()
+
+	// The stored version is sent when the period has already been reported with the same data,
+	// so manual edits of the report are not lost
+	saved, err := b.storage.SaveReport(ctx, result, userId)
+	if err != nil {
 		logger.ErrorContext(ctx, "failed to save report to DB", "reason", err)
+	} else {
+		result = saved
+		logger.InfoContext(ctx, "report saved", "report_id", saved.Id, "version", saved.Version)
+
+		if archive != nil {
+			b.saveArchive(ctx, saved.Id, *archive)
+		}
 	}
 
-	reportBytes, err := b.generator.Generate(reportData.Report)
+	reportBytes, err := b.generator.Generate(result)
 	if err != nil {
+		metrics.ReportGenerations.Inc(generationFailed)
 		logger.ErrorContext(ctx, "report generation failed", "reason", err)
 		return
 	}
+	metrics.ReportGenerations.Inc(generationSucceeded)
 
 	file := tg.FileBytes{
 		Name:  reportBytes.Name,
@@ -238,10 +541,52 @@ func (b *ReportsBot) processReportResult(ctx context.Context, reportData report.
 	}
 
 	msg := tg.NewDocument(chatId, file)
-	msg.Caption = reportFileCaption
+	msg.Caption = caption
 	if _, err = b.Bot.Send(msg); err != nil {
 		logger.ErrorContext(ctx, "failed to send report", "reason", err.Error())
 	}
+
+	if len(warnings) > 0 {
+		b.sendText(formatWarnings(warnings), chatId)
+	}
+}
+
+func formatWarnings(warnings []report.Warning) string {
+	var sb strings.Builder
+	sb.WriteString(reportIncompleteMsg)
+
+	for _, warning := range warnings {
+		switch warning.Kind {
+		case report.WarningCommitLinksUnavailable:
+			fmt.Fprintf(&sb, commitLinksUnavailableTemplate, warning.Task, warning.Source)
+		case report.WarningMergeRequestUnavailable:
+			fmt.Fprintf(&sb, mergeRequestUnavailableTemplate, warning.Task, warning.Source)
+		default:
+			fmt.Fprintf(&sb, unknownWarningTemplate, warning.Task, warning.Source)
+		}
+	}
+
+	return sb.String()
+}
+
+func (b *ReportsBot) handleBackup(ctx context.Context, chatId int64) {
+	logger := logger.GetFromContext(ctx)
+
+	if b.backups == nil {
+		b.sendText(backupNotSupportedMsg, chatId)
+		return
+	}
+
+	b.sendText(backupInProgressMsg, chatId)
+
+	path, err := b.backups.Backup(ctx)
+	if err != nil {
+		logger.ErrorContext(ctx, "backup failed", "reason", err)
+		b.sendText(backupFailedMsg, chatId)
+		return
+	}
+
+	b.sendText(fmt.Sprintf(backupHasBeenCreatedTemplate, filepath.Base(path)), chatId)
 }
 
 func (b *ReportsBot) handleRegistration(ctx context.Context, userId int64, chatId int64) {
@@ -286,15 +631,71 @@ func (b *ReportsBot) handleProfileInfo(ctx context.Context, userId int64, chatId
 	}
 
 	var tokenMsg string
+	var expiryMsg string
+	var expiresSoon bool
+	var expiresAt time.Time
+
 	if user.UserToken == empty {
 		tokenMsg = tokenIsNotSetMsg
+		expiryMsg = empty
 	} else {
 		tokenMsg = tokenIsSetMsg
+		expiryMsg = tokenExpiryUnknownMsg
+
+		tokenInfo, err := b.gitClient.TokenInfo(ctx, primaryAccount(user))
+		if err != nil {
+			logger.WarnContext(ctx, "failed to fetch token info", "reason", err)
+		} else if expiry, expires := tokenInfo.Expiry(); expires {
+			expiresAt = expiry
+			expiresSoon = b.isExpiringSoon(expiry)
+			expiryMsg = expiry.Format(time.DateOnly)
+		} else {
+			expiryMsg = tokenNeverExpiresMsg
+		}
 	}
 
-	responseMsg := fmt.Sprintf(profileCmdTemplate, user.TimezoneOffset, user.GitlabId, tokenMsg)
+	gitlabHost := user.GitlabHost
+	if gitlabHost == empty {
+		gitlabHost = b.config.GitlabHost()
+	}
+
+	responseMsg := fmt.Sprintf(profileCmdTemplate,
+		user.TimezoneOffset, gitlabHost, user.GitlabId, user.UserEmail, tokenMsg, expiryMsg)
 
 	b.sendText(responseMsg, chatId)
+
+	if expiresSoon {
+		b.sendText(fmt.Sprintf(tokenExpiresSoonTemplate, expiresAt.Format(time.DateOnly)), chatId)
+	}
+}
+
+func (b *ReportsBot) handleAccountsInfo(ctx context.Context, userId int64, chatId int64) {
+	logger := logger.GetFromContext(ctx)
+	if !b.storage.UserExists(ctx, userId) {
+		b.sendText(userNotRegisteredMsg, chatId)
+		return
+	}
+
+	accounts, err := b.storage.Accounts(ctx, userId)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to fetch linked accounts", "reason", err)
+		b.sendText(fetchAccountsFailedMsg, chatId)
+		return
+	}
+
+	if len(accounts) == 0 {
+		b.sendText(noLinkedAccountsMsg, chatId)
+		return
+	}
+
+	var responseMsg strings.Builder
+	responseMsg.WriteString(accountsCmdHeader)
+	for _, account := range accounts {
+		responseMsg.WriteString(fmt.Sprintf(accountsCmdRowTemplate,
+			account.Id, account.Host, account.Provider, account.ExternalId))
+	}
+
+	b.sendText(responseMsg.String(), chatId)
 }
 
 func (b *ReportsBot) handleUnregistration(ctx context.Context, userId int64, chatId int64) {
@@ -337,16 +738,248 @@ func (b *ReportsBot) setUserGitlabId(ctx context.Context, userInput string, chat
 
 func (b *ReportsBot) setUserToken(ctx context.Context, userInput string, chatId int64, dbUser report.User) {
 	logger := logger.GetFromContext(ctx)
-	updatedToken := strings.TrimPrefix(userInput, setTokenPrefix)
+	// Expected input: 'token:token' or 'token:host token' to update both as a pair
+	tokenData := strings.Fields(strings.TrimPrefix(userInput, setTokenPrefix))
+
+	var updatedToken string
+	switch len(tokenData) {
+	case 1:
+		updatedToken = tokenData[0]
+	case 2:
+		if !b.checkGitlabHost(ctx, tokenData[0], chatId) {
+			return
+		}
+		dbUser.GitlabHost = tokenData[0]
+		updatedToken = tokenData[1]
+	default:
+		logger.ErrorContext(ctx, "unexpected token input format", "fields", len(tokenData))
+		b.sendText(tokenBadInputMsg, chatId)
+		return
+	}
+
 	dbUser.UserToken = updatedToken
+	account := primaryAccount(dbUser)
+
+	gitlabUser, err := b.gitClient.CurrentUser(ctx, account)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to validate user's token", "reason", err)
+		b.sendText(gitlabErrorMsg(err, tokenCheckFailedMsg), chatId)
+		return
+	}
+
+	tokenInfo, rejectedMsg := b.checkTokenScopes(ctx, account)
+	if rejectedMsg != empty {
+		b.sendText(rejectedMsg, chatId)
+		return
+	}
+
+	dbUser.GitlabId = gitlabUser.Id
+	dbUser.UserEmail = gitlabUser.Email
 
 	if err := b.storage.UpdateUser(ctx, dbUser); err != nil {
 		logger.ErrorContext(ctx, "failed to update user's token", "reason", err)
 		b.sendText(userDataUpdateErrorMsg, chatId)
 		return
 	}
-	logger.InfoContext(ctx, "user token updated successfully")
-	b.sendText(tokenHasBeenSavedMsg, chatId)
+	logger.InfoContext(ctx, "user token updated successfully", "gitlab_id", dbUser.GitlabId, "host", dbUser.GitlabHost)
+	b.sendText(fmt.Sprintf(tokenHasBeenSavedTemplate, maskToken(updatedToken), dbUser.GitlabId, dbUser.UserEmail), chatId)
+
+	b.warnAboutExpiry(tokenInfo, chatId)
+}
+
+// Older gitlab versions do not provide token info, scopes are checked only when it is available.
+// Returns the token info, nil when it is not provided, and the reply to send when the token is rejected
+func (b *ReportsBot) checkTokenScopes(ctx context.Context, account report.Account) (*gitlab.PersonalAccessToken, string) {
+	logger := logger.GetFromContext(ctx)
+
+	tokenInfo, err := b.gitClient.TokenInfo(ctx, account)
+	if errors.Is(err, gitlab.ErrNotFound) {
+		logger.WarnContext(ctx, "token info is not provided by gitlab", "reason", err)
+		return nil, empty
+	}
+
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to fetch token info", "reason", err)
+		return nil, gitlabErrorMsg(err, tokenCheckFailedMsg)
+	}
+
+	if !tokenInfo.HasAnyScope(requiredTokenScopes...) {
+		logger.ErrorContext(ctx, "token lacks required scopes", "scopes", tokenInfo.Scopes)
+		return nil, tokenScopesMissingMsg
+	}
+
+	return tokenInfo, empty
+}
+
+func (b *ReportsBot) warnAboutExpiry(tokenInfo *gitlab.PersonalAccessToken, chatId int64) {
+	if tokenInfo == nil {
+		return
+	}
+
+	if expiresAt, expires := tokenInfo.Expiry(); expires && b.isExpiringSoon(expiresAt) {
+		b.sendText(fmt.Sprintf(tokenExpiresSoonTemplate, expiresAt.Format(time.DateOnly)), chatId)
+	}
+}
+
+func (b *ReportsBot) isExpiringSoon(expiresAt time.Time) bool {
+	warnFrom := expiresAt.AddDate(0, 0, -b.config.TokenExpiryWarnDays)
+	return time.Now().After(warnFrom)
+}
+
+// Explains gitlab API failures the user can do something about,
+// the fallback message is returned for any other error
+func gitlabErrorMsg(err error, fallback string) string {
+	switch {
+	case errors.Is(err, gitlab.ErrUnauthorized):
+		return gitlabUnauthorizedMsg
+	case errors.Is(err, gitlab.ErrForbidden):
+		return gitlabForbiddenMsg
+	case errors.Is(err, gitlab.ErrNotFound):
+		return gitlabNotFoundMsg
+	case errors.Is(err, gitlab.ErrRateLimited):
+		return gitlabRateLimitedMsg
+	case errors.Is(err, gitlab.ErrUnavailable):
+		return gitlabUnavailableMsg
+	default:
+		return fallback
+	}
+}
+
+// Returns the account configured with user's own gitlab id, token and host
+func primaryAccount(user report.User) report.Account {
+	return report.Account{
+		UserId:     user.Id,
+		Provider:   report.ProviderGitlab,
+		Host:       user.GitlabHost,
+		ExternalId: user.GitlabId,
+		Token:      user.UserToken,
+	}
+}
+
+func (b *ReportsBot) setUserGitlabHost(ctx context.Context, userInput string, chatId int64, dbUser report.User) {
+	logger := logger.GetFromContext(ctx)
+	updatedHost := strings.TrimSpace(strings.TrimPrefix(userInput, setHostPrefix))
+
+	if !b.checkGitlabHost(ctx, updatedHost, chatId) {
+		return
+	}
+
+	dbUser.GitlabHost = updatedHost
+
+	// Without a token the host is saved as is and gets checked when the token is set.
+	// Otherwise make sure the host is a gitlab instance the token is valid for
+	if dbUser.UserToken != empty {
+		if _, err := b.gitClient.CurrentUser(ctx, primaryAccount(dbUser)); err != nil {
+			logger.ErrorContext(ctx, "failed to validate gitlab host", "reason", err, "host", updatedHost)
+			b.sendText(gitlabErrorMsg(err, gitlabHostCheckFailedMsg), chatId)
+			return
+		}
+	}
+
+	if err := b.storage.UpdateUser(ctx, dbUser); err != nil {
+		logger.ErrorContext(ctx, "failed to update user's gitlab host", "reason", err)
+		b.sendText(userDataUpdateErrorMsg, chatId)
+		return
+	}
+
+	logger.InfoContext(ctx, "gitlab host updated successfully", "host", updatedHost)
+	b.sendText(gitlabHostHasBeenSavedMsg, chatId)
+}
+
+// Validates the host sent by the user, the reply is sent when the host is rejected
+func (b *ReportsBot) checkGitlabHost(ctx context.Context, host string, chatId int64) bool {
+	logger := logger.GetFromContext(ctx)
+
+	if host == empty || strings.ContainsAny(host, "/ ") {
+		logger.ErrorContext(ctx, "could not parse user input for gitlab host", "input", host)
+		b.sendText(gitlabHostBadInputMsg, chatId)
+		return false
+	}
+
+	if !b.config.IsGitHostAllowed(host) {
+		logger.ErrorContext(ctx, "gitlab host is not allowed", "host", host)
+		b.sendText(gitlabHostNotAllowedMsg, chatId)
+		return false
+	}
+
+	return true
+}
+
+func (b *ReportsBot) linkAccount(ctx context.Context, userInput string, chatId int64, dbUser report.User) {
+	logger := logger.GetFromContext(ctx)
+	// Expected input: 'account:host token'
+	accountData := strings.Fields(strings.TrimPrefix(userInput, linkAccountPrefix))
+
+	if len(accountData) != 2 {
+		logger.ErrorContext(ctx, "unexpected account input format", "fields", len(accountData))
+		b.sendText(accountBadInputErrorMsg, chatId)
+		return
+	}
+
+	account := report.Account{
+		UserId:   dbUser.Id,
+		Provider: report.ProviderGitlab,
+		Host:     accountData[0],
+		Token:    accountData[1],
+	}
+
+	if !b.config.IsGitHostAllowed(account.Host) {
+		logger.ErrorContext(ctx, "gitlab host is not allowed", "host", account.Host)
+		b.sendText(gitlabHostNotAllowedMsg, chatId)
+		return
+	}
+
+	// The account belongs to the user the token has been issued for
+	gitlabUser, err := b.gitClient.CurrentUser(ctx, account)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to validate account", "reason", err, "host", account.Host)
+		b.sendText(gitlabErrorMsg(err, gitlabHostCheckFailedMsg), chatId)
+		return
+	}
+	account.ExternalId = gitlabUser.Id
+
+	tokenInfo, rejectedMsg := b.checkTokenScopes(ctx, account)
+	if rejectedMsg != empty {
+		b.sendText(rejectedMsg, chatId)
+		return
+	}
+
+	accountId, err := b.storage.AddAccount(ctx, account)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to link account", "reason", err)
+		b.sendText(userDataUpdateErrorMsg, chatId)
+		return
+	}
+
+	logger.InfoContext(ctx, "account linked successfully",
+		"account_id", accountId, "host", account.Host, "gitlab_id", account.ExternalId)
+	b.sendText(fmt.Sprintf(accountHasBeenLinkedTemplate, account.Host, account.ExternalId, maskToken(account.Token)), chatId)
+	b.warnAboutExpiry(tokenInfo, chatId)
+}
+
+func (b *ReportsBot) unlinkAccount(ctx context.Context, userInput string, chatId int64, dbUser report.User) {
+	logger := logger.GetFromContext(ctx)
+	inputAccountId := strings.TrimPrefix(userInput, unlinkPrefix)
+	accountId, err := strconv.ParseInt(inputAccountId, 10, 64)
+
+	if err != nil {
+		logger.ErrorContext(ctx, "could not parse user input for account id", "reason", err)
+		b.sendText(accountBadInputErrorMsg, chatId)
+		return
+	}
+
+	if err := b.storage.RemoveAccount(ctx, dbUser.Id, accountId); err != nil {
+		logger.ErrorContext(ctx, "failed to unlink account", "reason", err)
+		if errors.Is(err, storage.ErrAccountNotFound) {
+			b.sendText(accountNotFoundErrorMsg, chatId)
+			return
+		}
+		b.sendText(userDataUpdateErrorMsg, chatId)
+		return
+	}
+
+	logger.InfoContext(ctx, "account unlinked successfully", "account_id", accountId)
+	b.sendText(accountHasBeenUnlinkedMsg, chatId)
 }
 
 func (b *ReportsBot) setUserTimezoneOffset(ctx context.Context, userInput string, chatId int64, dbUser report.User) {
@@ -375,6 +1008,13 @@ func (b *ReportsBot) setUserTimezoneOffset(ctx context.Context, userInput string
 	b.sendText(timezoneHasBeenSavedMsg, chatId)
 }
 
+func (b *ReportsBot) deleteMessage(ctx context.Context, chatId int64, messageId int) {
+	logger := logger.GetFromContext(ctx)
+	if _, err := b.Bot.Request(tg.NewDeleteMessage(chatId, messageId)); err != nil {
+		logger.ErrorContext(ctx, "failed to delete message", "reason", err, "message_id", messageId)
+	}
+}
+
 func (b *ReportsBot) sendText(text string, chatId int64) {
 	message := tg.NewMessage(int64(chatId), empty)
 	message.Text = text
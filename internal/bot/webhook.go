@@ -0,0 +1,169 @@
+package bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	tg "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Header telegram puts the secret token set with setWebhook into
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// Telegram accepts 1-256 characters A-Z, a-z, 0-9, _ and -
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// Receives updates pushed by telegram to the webhook
+type WebhookHandler struct {
+	secret  string
+	updates chan tg.Update
+}
+
+func NewWebhookHandler(secret string, buffer int) *WebhookHandler {
+	return &WebhookHandler{
+		secret:  secret,
+		updates: make(chan tg.Update, buffer),
+	}
+}
+
+func (h *WebhookHandler) Updates() tg.UpdatesChannel {
+	return h.updates
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	secret := r.Header.Get(secretTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(h.secret)) != 1 {
+		slog.WarnContext(r.Context(), "webhook request with invalid secret token", "remote_addr", r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var update tg.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		slog.WarnContext(r.Context(), "could not decode webhook update", "reason", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Telegram redelivers the update later when it has not been accepted
+	select {
+	case h.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// Starts the webhook server and registers it in telegram.
+// Returns updates channel and the function unregistering the webhook and stopping the server
+func (b *ReportsBot) startWebhook(ctx context.Context) (tg.UpdatesChannel, func(), error) {
+	if b.config.WebhookUrl == "" {
+		return nil, nil, errors.New("webhook url is not configured")
+	}
+
+	if !webhookSecretPattern.MatchString(b.config.WebhookSecret) {
+		return nil, nil, errors.New("webhook secret must be 1-256 characters of A-Z, a-z, 0-9, _ and -")
+	}
+
+	handler := NewWebhookHandler(b.config.WebhookSecret, b.Bot.Buffer)
+	mux := http.NewServeMux()
+	mux.Handle(b.config.WebhookPath, handler)
+
+	srv := &http.Server{
+		Addr:              b.config.WebhookListenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	// Bind before registering the webhook so a busy or bad address fails the startup
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen for webhook requests: %w", err)
+	}
+
+	go func() {
+		slog.InfoContext(ctx, "webhook server listening", "addr", ln.Addr().String(), "path", b.config.WebhookPath)
+
+		var err error
+		if b.config.WebhookTlsCert != "" {
+			err = srv.ServeTLS(ln, b.config.WebhookTlsCert, b.config.WebhookTlsKey)
+		} else {
+			err = srv.Serve(ln)
+		}
+
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.ErrorContext(ctx, "webhook server failed", "reason", err)
+		}
+	}()
+
+	if err := b.setWebhook(); err != nil {
+		srv.Close()
+		return nil, nil, err
+	}
+
+	stop := func() {
+		if _, err := b.Bot.Request(tg.DeleteWebhookConfig{}); err != nil {
+			slog.WarnContext(ctx, "could not delete webhook", "reason", err)
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.WarnContext(ctx, "could not shut down webhook server", "reason", err)
+		}
+	}
+
+	return handler.Updates(), stop, nil
+}
+
+// The library does not support secret tokens, so the request is made by hand
+func (b *ReportsBot) setWebhook() error {
+	params := tg.Params{}
+	params["url"] = b.config.WebhookUrl
+	params["secret_token"] = b.config.WebhookSecret
+
+	// Only messages are handled
+	if err := params.AddInterface("allowed_updates", []string{"message"}); err != nil {
+		return err
+	}
+
+	if _, err := b.Bot.MakeRequest("setWebhook", params); err != nil {
+		return fmt.Errorf("could not set webhook: %w", err)
+	}
+
+	return nil
+}
+
+// Updates can not be polled while a webhook is set, e.g. after switching back from webhook mode
+func (b *ReportsBot) startPolling(ctx context.Context) (tg.UpdatesChannel, func(), error) {
+	info, err := b.Bot.GetWebhookInfo()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not get webhook info: %w", err)
+	}
+
+	if info.IsSet() {
+		slog.InfoContext(ctx, "deleting webhook to poll updates", "url", info.URL)
+		if _, err := b.Bot.Request(tg.DeleteWebhookConfig{}); err != nil {
+			return nil, nil, fmt.Errorf("could not delete webhook: %w", err)
+		}
+	}
+
+	updateConfig := tg.NewUpdate(0)
+	updateConfig.Timeout = b.config.CommandsTimeout
+
+	return b.Bot.GetUpdatesChan(updateConfig), b.Bot.StopReceivingUpdates, nil
+}
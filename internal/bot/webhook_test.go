@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testUpdate = `{
+  "update_id": 10000,
+  "message": {
+    "message_id": 1365,
+    "date": 1696528116,
+    "chat": {"id": 1111111, "type": "private"},
+    "from": {"id": 1111111, "is_bot": false, "first_name": "Test"},
+    "text": "/help",
+    "entities": [{"type": "bot_command", "offset": 0, "length": 5}]
+  }
+}`
+
+func TestWebhookAcceptsUpdate(t *testing.T) {
+	handler := NewWebhookHandler("s3cret", 1)
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(testUpdate))
+	if err != nil {
+		t.Fatalf("could not create request: %v", err)
+	}
+	req.Header.Set(secretTokenHeader, "s3cret")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+
+	select {
+	case update := <-handler.Updates():
+		if update.UpdateID != 10000 || update.Message == nil || update.Message.Command() != helpCmd {
+			t.Errorf("update = %+v, want /help message", update)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("update has not been received")
+	}
+}
+
+func TestWebhookRejectsRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		secret     string
+		body       string
+		wantStatus int
+	}{
+		{"missing secret", http.MethodPost, "", testUpdate, http.StatusUnauthorized},
+		{"wrong secret", http.MethodPost, "guess", testUpdate, http.StatusUnauthorized},
+		{"wrong method", http.MethodGet, "s3cret", "", http.StatusMethodNotAllowed},
+		{"malformed update", http.MethodPost, "s3cret", "{", http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewWebhookHandler("s3cret", 1)
+			req := httptest.NewRequest(tc.method, "/telegram/webhook", strings.NewReader(tc.body))
+			if tc.secret != "" {
+				req.Header.Set(secretTokenHeader, tc.secret)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+
+			if len(handler.updates) != 0 {
+				t.Error("rejected update has been queued")
+			}
+		})
+	}
+}
@@ -25,6 +25,8 @@ var tpls embed.FS
 
 const pathToBin = "./bin/"
 
+const format = "html"
+
 func New(reportsDir string, tmplName string, saveToDisk bool) *HtmlGenerator {
 	return &HtmlGenerator{
 		reportsDir: reportsDir,
@@ -33,6 +35,10 @@ func New(reportsDir string, tmplName string, saveToDisk bool) *HtmlGenerator {
 	}
 }
 
+func (g *HtmlGenerator) Format() string {
+	return format
+}
+
 func (g *HtmlGenerator) Generate(data report.Report) (report.Result, error) {
 	tmpl, err := template.ParseFS(tpls, g.tmplName)
 	if err != nil {
@@ -0,0 +1,54 @@
+package gitlab
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/BalanceBalls/report-generator/internal/report"
+)
+
+// Compresses the recording to be archived along with the report built from it
+func EncodeRecording(recording Recording) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+
+	if err := json.NewEncoder(writer).Encode(recording); err != nil {
+		return nil, fmt.Errorf("could not encode recording: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("could not compress recording: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func DecodeRecording(data []byte) (Recording, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return Recording{}, fmt.Errorf("could not decompress recording: %w", err)
+	}
+	defer reader.Close()
+
+	raw, err := io.ReadAll(reader)
+	if err != nil {
+		return Recording{}, fmt.Errorf("could not decompress recording: %w", err)
+	}
+
+	return parseRecording(raw)
+}
+
+// Builds the report again from the recorded responses with the current builder logic.
+// Requests the recording has no response for fail with ErrNotRecorded
+func Recompute(ctx context.Context, recording Recording, workers int) (report.Report, error) {
+	client, err := NewReplayClient(recording)
+	if err != nil {
+		return report.Report{}, err
+	}
+
+	return NewReportBuilder(*client, workers).Build(ctx, recording.ReplayUser(), recording.Period)
+}
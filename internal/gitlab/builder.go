@@ -2,6 +2,7 @@ package gitlab
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path"
 	"strings"
@@ -25,52 +26,135 @@ const (
 	mergeRequestTarget = "MergeRequest"
 )
 
+// Merge request states a branch is worked on in
+var trackedMergeRequestStates = []string{"opened", "merged"}
+
+// Sent as commit_from by pushes creating a branch
+const zeroCommit = "0000000000000000000000000000000000000000"
+
 var branches2exclude = []string{"main", "master", "develop"}
 var trackedActions = []string{initCommit, commit, createMergeRequest, acceptMergeRequest}
 
 type GitlabBuilder struct {
 	client GitlabClient
+	// Concurrent requests to gitlab made by every stage of building a report
+	workers int
 }
 
-func NewReportBuilder(client GitlabClient) *GitlabBuilder {
+func NewReportBuilder(client GitlabClient, workers int) *GitlabBuilder {
 	return &GitlabBuilder{
-		client: client,
+		client:  client,
+		workers: workers,
 	}
 }
 
-func (gb *GitlabBuilder) Build(ctx context.Context, user report.User, respch chan report.Channel) {
+// Builds the report of git actions made by every account of the user during the period.
+// Parts which could not be built are listed in the report's warnings
+func (gb *GitlabBuilder) Build(ctx context.Context, user report.User, period report.Period) (report.Report, error) {
 	logger := logger.GetFromContext(ctx)
+	accounts := user.SourceAccounts()
+
+	if len(accounts) == 0 {
+		return report.Report{}, ErrNoAccounts
+	}
+
+	logger.InfoContext(ctx, "starting report building..",
+		"tzOffset", user.TimezoneOffset,
+		"accounts", len(accounts),
+		"periodStart", period.Start,
+		"periodEnd", period.End)
+
+	results := make([]accountResult, len(accounts))
+
+	err := forEach(ctx, gb.workers, len(accounts), func(ctx context.Context, i int) error {
+		res, err := gb.buildForAccount(ctx, accounts[i], period)
+		if errors.Is(err, ErrNoGitActions) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to build report for %q: %w", gb.client.Host(accounts[i]), err)
+		}
+
+		results[i] = res
+		return nil
+	})
+	if err != nil {
+		return report.Report{}, err
+	}
+
+	sources := make([]string, 0, len(accounts))
+	for _, account := range accounts {
+		if source := gb.client.Host(account); !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+
 	result := report.Report{
-		UserId: user.Id,
+		UserId:      user.Id,
+		PeriodStart: period.Start,
+		PeriodEnd:   period.End,
+		Source:      strings.Join(sources, ", "),
 	}
 
-	logger.InfoContext(ctx, "starting report building..", "tzOffset", user.TimezoneOffset)
+	for _, res := range results {
+		result.Rows = append(result.Rows, res.rows...)
+		result.Warnings = append(result.Warnings, res.warnings...)
+	}
 
-	// Current time with the server's offset
-	pointOfReference := time.Now().UTC().Add(time.Minute * time.Duration(user.TimezoneOffset))
-	// Get start time of the current day
-	timeRangeStart := pointOfReference.Truncate(time.Hour * 24)
-	// Set time range to a whole day
-	timeRangeEnd := timeRangeStart.Add(time.Hour * 24)
+	if len(result.Rows) == 0 {
+		return report.Report{}, ErrNoGitActions
+	}
+
+	// Rows of every account are ordered by time already,
+	// merge them keeping the order across accounts
+	slices.SortStableFunc(result.Rows, func(i, j report.ReportRow) int {
+		return i.Date.Compare(j.Date)
+	})
 
-	before := pointOfReference.AddDate(0, 0, 1)
-	after := pointOfReference.AddDate(0, 0, -1)
+	return result, nil
+}
 
-	events, err := gb.client.Events(ctx, user, before, after)
-	handleErr(err, respch)
+type accountResult struct {
+	rows     []report.ReportRow
+	warnings []report.Warning
+}
+
+// Builds report rows from git actions of a single account
+func (gb *GitlabBuilder) buildForAccount(ctx context.Context, account report.Account, period report.Period) (accountResult, error) {
+	// Gitlab filters events by UTC dates, both bounds are exclusive
+	before := period.End.UTC().AddDate(0, 0, 1)
+	after := period.Start.UTC().AddDate(0, 0, -1)
+
+	events, err := gb.client.Events(ctx, account, before, after)
+	if err != nil {
+		return accountResult{}, err
+	}
 
-	var filteredEvents []Event
-	filteredEvents, err = filterByTime(events, timeRangeStart, timeRangeEnd)
-	handleErr(err, respch)
+	filteredEvents, err := filterByTime(events, period.Start, period.End)
+	if err != nil {
+		return accountResult{}, err
+	}
 
 	filteredEvents, err = filterByBranches(filteredEvents)
-	handleErr(err, respch)
+	if err != nil {
+		return accountResult{}, err
+	}
 
 	filteredEvents, err = filterByActions(filteredEvents)
-	handleErr(err, respch)
+	if err != nil {
+		return accountResult{}, err
+	}
+
+	filteredEvents, err = gb.loadMergeRequests(ctx, account, filteredEvents)
+	if err != nil {
+		return accountResult{}, err
+	}
 
-	filteredEvents, err = gb.loadMergeRequests(ctx, user, filteredEvents)
-	handleErr(err, respch)
+	filteredEvents, err = gb.expandPushes(ctx, account, filteredEvents, period)
+	if err != nil {
+		return accountResult{}, err
+	}
 
 	sortEvents(filteredEvents)
 	branch2events := groupByBranches(filteredEvents)
@@ -81,73 +165,245 @@ func (gb *GitlabBuilder) Build(ctx context.Context, user report.User, respch cha
 	var prevTime = filteredEvents[0].CreatedAt
 	prevTime = initPrevTime(branch2events, prevTime)
 
-	for _, branchName := range orderedBranches {
-		events := branch2events[branchName]
-		row := gb.buildRow(ctx, user, branchName, events, prevTime)
-		result.Rows = append(result.Rows, row)
+	// Starting points only depend on events, so rows can be built concurrently
+	prevTimes := make([]time.Time, len(orderedBranches))
+	for i, branchName := range orderedBranches {
+		prevTimes[i] = prevTime
 
 		// Use time of the last event for the branch
 		// as a backup staring point for the next branch
+		events := branch2events[branchName]
 		prevTime = events[len(events)-1].CreatedAt
 	}
 
-	respch <- report.Channel{
-		Report: result,
-		Err:    nil,
+	source := gb.client.Host(account)
+	rows := make([]report.ReportRow, len(orderedBranches))
+	warnings := make([][]report.Warning, len(orderedBranches))
+
+	err = forEach(ctx, gb.workers, len(orderedBranches), func(ctx context.Context, i int) error {
+		row, rowWarnings, err := gb.buildRow(ctx, account, branch2events[orderedBranches[i]], prevTimes[i])
+		if err != nil {
+			return err
+		}
+
+		row.Source = source
+		rows[i] = row
+		for j := range rowWarnings {
+			rowWarnings[j].Source = source
+		}
+		warnings[i] = rowWarnings
+		return nil
+	})
+	if err != nil {
+		return accountResult{}, err
+	}
+
+	result := accountResult{rows: rows}
+	for _, rowWarnings := range warnings {
+		result.warnings = append(result.warnings, rowWarnings...)
 	}
+
+	return result, nil
 }
 
-func (gb *GitlabBuilder) loadMergeRequests(ctx context.Context, user report.User, events []Event) ([]Event, error) {
-	loaded := map[int]MergeRequest{}
+// Merge request iids are only unique within a project
+type mergeRequestKey struct {
+	projectId int
+	iid       int
+}
+
+func (gb *GitlabBuilder) loadMergeRequests(ctx context.Context, account report.Account, events []Event) ([]Event, error) {
+	var keys []mergeRequestKey
+	for _, event := range events {
+		key := mergeRequestKey{projectId: event.ProjectId, iid: event.TargetIid}
+		if event.TargetType == mergeRequestTarget && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	mergeRequests := make([]*MergeRequest, len(keys))
+	err := forEach(ctx, gb.workers, len(keys), func(ctx context.Context, i int) error {
+		mr, err := gb.client.MergeRequest(ctx, account, keys[i].projectId, keys[i].iid)
+		if err != nil {
+			return fmt.Errorf("could not get MR data: %w", err)
+		}
+
+		mergeRequests[i] = mr
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	for i, event := range events {
+		if event.TargetType != mergeRequestTarget {
+			continue
+		}
+
+		key := mergeRequestKey{projectId: event.ProjectId, iid: event.TargetIid}
+		events[i].MR = mergeRequests[slices.Index(keys, key)]
+	}
+
+	return events, nil
+}
+
+// Replaces every push with events of the pushed commits timed by their authoring.
+// Pushes whose commits could not be fetched from gitlab are kept timed by the push itself,
+// replays fail instead, so a report is not recomputed from an archive lacking them
+func (gb *GitlabBuilder) expandPushes(
+	ctx context.Context, account report.Account, events []Event, period report.Period,
+) ([]Event, error) {
+	logger := logger.GetFromContext(ctx)
+	pushed := make([][]Commit, len(events))
+
+	err := forEach(ctx, gb.workers, len(events), func(ctx context.Context, i int) error {
+		if events[i].MR != nil || events[i].PushData.CommitTo == "" {
+			return nil
+		}
+
+		commits, err := gb.getPushedCommits(ctx, account, events[i])
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		if errors.Is(err, ErrNotRecorded) {
+			return err
+		}
 
-		tmr, isLoaded := loaded[event.TargetIid]
-		if isLoaded {
-			events[i].MR = &tmr
+		if err != nil {
+			logger.WarnContext(ctx, "could not get pushed commits, push time is used instead",
+				"reason", err, "project", events[i].ProjectId, "commit", events[i].PushData.CommitTo)
+			return nil
+		}
+
+		pushed[i] = commits
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Event, 0, len(events))
+	for i, event := range events {
+		if len(pushed[i]) == 0 {
+			result = append(result, event)
 			continue
 		}
 
-		if event.TargetType == mergeRequestTarget {
-			mr, err := gb.client.MergeRequest(ctx, user, event.ProjectId, event.TargetIid)
+		for _, commit := range pushed[i] {
+			commit := commit
+			expanded := event
+			expanded.Commit = &commit
+			expanded.CreatedAt = getCommitTime(commit, period.Start, event.CreatedAt)
+			expanded.PushData.CommitTo = commit.Id
+			expanded.PushData.CommitTitle = commit.Title
+			result = append(result, expanded)
+		}
+	}
 
-			if err != nil {
-				return nil, fmt.Errorf("could not get MR data: %w", err)
-			}
+	return result, nil
+}
+
+// Returns commits of the push, the oldest first
+func (gb *GitlabBuilder) getPushedCommits(ctx context.Context, account report.Account, push Event) ([]Commit, error) {
+	data := push.PushData
 
-			events[i].MR = mr
-			loaded[event.TargetIid] = *mr
+	if data.CommitFrom != "" && data.CommitFrom != zeroCommit {
+		return gb.client.CompareCommits(ctx, account, push.ProjectId, data.CommitFrom, data.CommitTo)
+	}
+
+	// A new branch has nothing to compare with, its last commits are the pushed ones
+	if data.CommitCount > 1 {
+		commits, err := gb.client.CommitHistory(ctx, account, push.ProjectId, data.CommitTo, data.CommitCount)
+		if err != nil {
+			return nil, err
 		}
+
+		slices.Reverse(commits)
+		return commits, nil
 	}
 
-	return events, nil
+	commit, err := gb.client.Commit(ctx, account, push.ProjectId, data.CommitTo)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Commit{*commit}, nil
+}
+
+// Commits authored before the period or after the push, e.g. rebased ones,
+// are timed by the push
+func getCommitTime(commit Commit, periodStart time.Time, pushedAt time.Time) time.Time {
+	if commit.AuthoredDate.Before(periodStart) || commit.AuthoredDate.After(pushedAt) {
+		return pushedAt
+	}
+
+	return commit.AuthoredDate
 }
 
+// Fails only when the context is done or the replayed recording lacks the branch MR lookup,
+// the row is built without the MR or commit links
+// and warnings are returned when they could not be fetched
 func (gb *GitlabBuilder) buildRow(
-	ctx context.Context, user report.User, branchName string, branchEvents []Event, prevTime time.Time,
-) report.ReportRow {
+	ctx context.Context, account report.Account, branchEvents []Event, prevTime time.Time,
+) (report.ReportRow, []report.Warning, error) {
 
 	var taskName string
 	var taskLink string
 	var actionLinks []string
+	var warnings []report.Warning
 
 	hasMr, mergeRequest := tryGetMrForBranch(branchEvents)
+	if !hasMr {
+		// The branch may have an MR opened on another day
+		var err error
+		mergeRequest, err = gb.findBranchMergeRequest(ctx, account, branchEvents[0])
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return report.ReportRow{}, nil, ctxErr
+		}
+
+		// Archives made before the lookup was introduced can not be recomputed
+		if errors.Is(err, ErrNotRecorded) {
+			return report.ReportRow{}, nil, err
+		}
+
+		if err != nil {
+			warnings = append(warnings, report.Warning{
+				Kind:   report.WarningMergeRequestUnavailable,
+				Task:   branchEvents[0].PushData.Ref,
+				Reason: err.Error(),
+			})
+		}
+	}
+
 	if hasMr {
 		// If a branch has an MR
 		taskName = mergeRequest.IssueUrl
 		mrLinks := getMergeRequestLinks(branchEvents)
 		actionLinks = append(actionLinks, mrLinks...)
+	} else if mergeRequest != nil {
+		taskName = mergeRequest.IssueUrl
+		actionLinks = append(actionLinks, mergeRequest.WebUrl)
 	} else {
 		// If no MR for a branch - set branch name as task name
 		taskName = branchEvents[0].PushData.Ref
 	}
 
-	commitLinks, err := gb.getCommitLinks(ctx, user, branchEvents)
+	commitLinks, err := gb.getCommitLinks(ctx, account, branchEvents)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return report.ReportRow{}, nil, ctxErr
+	}
+
 	if err != nil {
-		taskLink = "Failed to get commits"
+		warnings = append(warnings, report.Warning{
+			Kind:   report.WarningCommitLinksUnavailable,
+			Task:   taskName,
+			Reason: err.Error(),
+		})
 	} else {
 		actionLinks = append(actionLinks, commitLinks...)
-		taskLink = strings.Join(actionLinks, " \n ")
 	}
+	taskLink = strings.Join(actionLinks, " \n ")
 
 	timeSpent := getHoursSpentOnBranch(prevTime, branchEvents)
 	result := report.ReportRow{
@@ -161,41 +417,76 @@ func (gb *GitlabBuilder) buildRow(
 		TimeSpent: float32(timeSpent),
 	}
 
-	return result
+	return result, warnings, nil
 }
 
-func (gb *GitlabBuilder) getCommitLinks(ctx context.Context, user report.User, branchEvents []Event) ([]string, error) {
-	var result []string
+// Returns the latest open or merged MR made from the pushed branch, nil when there is none
+func (gb *GitlabBuilder) findBranchMergeRequest(ctx context.Context, account report.Account, push Event) (*MergeRequest, error) {
+	if push.PushData.Ref == "" {
+		return nil, nil
+	}
 
-	var firstCommit Event
+	mergeRequests, err := gb.client.BranchMergeRequests(ctx, account, push.ProjectId, push.PushData.Ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find branch MR: %w", err)
+	}
+
+	for i := range mergeRequests {
+		if slices.Contains(trackedMergeRequestStates, mergeRequests[i].State) {
+			return &mergeRequests[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (gb *GitlabBuilder) getCommitLinks(ctx context.Context, account report.Account, branchEvents []Event) ([]string, error) {
+	var result []string
+	var commitEvents []Event
+	var commitBaseUrl string
 
 	for _, event := range branchEvents {
-		if event.MR == nil {
-			firstCommit = event
-			break
+		if event.MR != nil {
+			continue
+		}
+
+		commitEvents = append(commitEvents, event)
+		if commitBaseUrl == "" && event.Commit != nil {
+			commitBaseUrl = getCommitBaseUrl(event.Commit.WebUrl)
 		}
 	}
 
-	// Get info about any single commit in order to
-	// acquire base commit URL which will be used for other commits
-	commitInfo, err := gb.client.Commit(
-		ctx,
-		user,
-		firstCommit.ProjectId,
-		firstCommit.PushData.CommitTo)
+	// Branch has only merge request events
+	if len(commitEvents) == 0 {
+		return nil, nil
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch commit info: %w", err)
+	// Pushes which have not been expanded into commits only know the hash
+	unexpanded := slices.IndexFunc(commitEvents, func(event Event) bool { return event.Commit == nil })
+	if unexpanded >= 0 && commitBaseUrl == "" {
+		// Get info about any single commit in order to
+		// acquire base commit URL which will be used for other commits
+		commitInfo, err := gb.client.Commit(
+			ctx,
+			account,
+			commitEvents[unexpanded].ProjectId,
+			commitEvents[unexpanded].PushData.CommitTo)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch commit info: %w", err)
+		}
+
+		commitBaseUrl = getCommitBaseUrl(commitInfo.WebUrl)
 	}
 
-	// Construct base commit url by removing
-	// commit hash from the endpoint path
-	hash := path.Base(commitInfo.WebUrl)
-	commitBaseUrl := strings.ReplaceAll(commitInfo.WebUrl, hash, "")
+	for _, event := range commitEvents {
+		url := commitBaseUrl + event.PushData.CommitTo
+		if event.Commit != nil && event.Commit.WebUrl != "" {
+			url = event.Commit.WebUrl
+		}
 
-	for _, event := range branchEvents {
-		if event.MR == nil {
-			url := commitBaseUrl + event.PushData.CommitTo
+		// The same commit is pushed again after a force push
+		if !slices.Contains(result, url) {
 			result = append(result, url)
 		}
 	}
@@ -203,8 +494,16 @@ func (gb *GitlabBuilder) getCommitLinks(ctx context.Context, user report.User, b
 	return result, nil
 }
 
+// Construct base commit url by removing
+// commit hash from the endpoint path
+func getCommitBaseUrl(commitUrl string) string {
+	hash := path.Base(commitUrl)
+	return strings.ReplaceAll(commitUrl, hash, "")
+}
+
+// Events of the same time keep the order gitlab returned them in
 func sortEvents(events []Event) []Event {
-	slices.SortFunc(events, func(i, j Event) int {
+	slices.SortStableFunc(events, func(i, j Event) int {
 		return i.CreatedAt.Compare(j.CreatedAt)
 	})
 
@@ -212,27 +511,25 @@ func sortEvents(events []Event) []Event {
 }
 
 // Rerutns a slice of strings which represents
-// an ordered by time array of branch names
+// an ordered by time array of branch names.
+// Branches started at the same time are ordered by name
 func sortBranches(branch2events map[string][]Event) []string {
 	result := make([]string, 0, len(branch2events))
-	time2branch := make(map[time.Time]string, len(branch2events))
-	sortedTime := make([]time.Time, 0, len(branch2events))
+	startedAt := make(map[string]time.Time, len(branch2events))
 
 	for k, v := range branch2events {
 		tempEvents := sortEvents(v)
-		minTime := tempEvents[0].CreatedAt
-
-		sortedTime = append(sortedTime, minTime)
-		time2branch[minTime] = k
+		startedAt[k] = tempEvents[0].CreatedAt
+		result = append(result, k)
 	}
 
-	slices.SortFunc(sortedTime, func(i, j time.Time) int {
-		return i.Compare(j)
-	})
+	slices.SortFunc(result, func(i, j string) int {
+		if byTime := startedAt[i].Compare(startedAt[j]); byTime != 0 {
+			return byTime
+		}
 
-	for _, t := range sortedTime {
-		result = append(result, time2branch[t])
-	}
+		return strings.Compare(i, j)
+	})
 
 	return result
 }
@@ -270,7 +567,7 @@ func filterByTime(events []Event, start time.Time, end time.Time) ([]Event, erro
 	result := []Event{}
 
 	for _, event := range events {
-		if event.CreatedAt.After(start) && event.CreatedAt.Before(end) {
+		if !event.CreatedAt.Before(start) && event.CreatedAt.Before(end) {
 			result = append(result, event)
 		}
 	}
@@ -384,6 +681,7 @@ func tryGetMrForBranch(branchEvents []Event) (bool, *MergeRequest) {
 	return false, nil
 }
 
+// Pushes expanded into commits are counted by every commit
 func getCommitsCountForBranch(branchEvents []Event) int {
 	result := 0
 	for _, event := range branchEvents {
@@ -394,12 +692,3 @@ func getCommitsCountForBranch(branchEvents []Event) int {
 
 	return result
 }
-
-func handleErr(err error, respch chan report.Channel) {
-	if err != nil {
-		respch <- report.Channel{
-			Report: report.Report{},
-			Err:    err,
-		}
-	}
-}
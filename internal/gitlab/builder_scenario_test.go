@@ -0,0 +1,205 @@
+package gitlab_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/gitlab"
+	"github.com/BalanceBalls/report-generator/internal/gitlab/gitlabtest"
+	"github.com/BalanceBalls/report-generator/internal/report"
+)
+
+const commitUrl = "https://gitlab.example.com/group/project/-/commit/"
+
+func TestBuildScenarios(t *testing.T) {
+	day := time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		scenario string
+		offset   int
+		wantRows []report.ReportRow
+		wantErr  error
+	}{
+		{
+			name:     "single branch",
+			scenario: "single_branch.json",
+			wantRows: []report.ReportRow{{
+				Date:      time.Date(2023, 10, 5, 10, 0, 0, 0, time.UTC),
+				Task:      "feature-1",
+				Link:      commitUrl + "3f2a9c17 \n " + commitUrl + "b84d6e02",
+				TimeSpent: 3,
+			}},
+		},
+		{
+			// Pushes are timed by their commits, the cherry-picked one authored days ago by the push
+			name:     "pushes of several commits",
+			scenario: "multi_commit_push.json",
+			wantRows: []report.ReportRow{{
+				Date: time.Date(2023, 10, 5, 8, 30, 0, 0, time.UTC),
+				Task: "feature-push",
+				Link: commitUrl + "f1f1f1f1 \n " + commitUrl + "f2f2f2f2 \n " + commitUrl + "f3f3f3f3 \n " +
+					commitUrl + "f4f4f4f4 \n " + commitUrl + "f5f5f5f5",
+				TimeSpent: 3.5,
+			}},
+		},
+		{
+			// Time of feature-b is covered by feature-a started earlier
+			name:     "overlapping branches",
+			scenario: "overlapping_branches.json",
+			wantRows: []report.ReportRow{
+				{
+					Date:      time.Date(2023, 10, 5, 10, 0, 0, 0, time.UTC),
+					Task:      "feature-a",
+					Link:      commitUrl + "a1a1a1a1 \n " + commitUrl + "a4a4a4a4",
+					TimeSpent: 4,
+				},
+				{
+					Date:      time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC),
+					Task:      "feature-b",
+					Link:      commitUrl + "b2b2b2b2 \n " + commitUrl + "b3b3b3b3",
+					TimeSpent: 0,
+				},
+			},
+		},
+		{
+			// Merge requests of gitlab carry no issue link, so the task is left empty
+			name:     "merge requests only",
+			scenario: "mr_only.json",
+			wantRows: []report.ReportRow{{
+				Date:      time.Date(2023, 10, 5, 15, 0, 0, 0, time.UTC),
+				Link:      "https://gitlab.example.com/group/project/-/merge_requests/5",
+				TimeSpent: 2,
+			}},
+		},
+		{
+			// The MR has been opened the day before, the closed one of the branch is ignored
+			name:     "merge request opened on another day",
+			scenario: "mr_between_days.json",
+			wantRows: []report.ReportRow{{
+				Date: time.Date(2023, 10, 5, 10, 0, 0, 0, time.UTC),
+				Link: "https://gitlab.example.com/group/project/-/merge_requests/12 \n " +
+					commitUrl + "c2c2c2c2 \n " + commitUrl + "c3c3c3c3",
+				TimeSpent: 3,
+			}},
+		},
+		{
+			name:     "day of the user ahead of UTC",
+			scenario: "timezone_edges.json",
+			offset:   180,
+			wantRows: []report.ReportRow{{
+				Date:      time.Date(2023, 10, 4, 21, 30, 0, 0, time.UTC),
+				Task:      "feature-tz",
+				Link:      commitUrl + "e1e1e1e1 \n " + commitUrl + "e2e2e2e2",
+				TimeSpent: 23,
+			}},
+		},
+		{
+			name:     "day of the user behind UTC",
+			scenario: "timezone_edges.json",
+			offset:   -300,
+			wantRows: []report.ReportRow{{
+				Date:      time.Date(2023, 10, 5, 20, 30, 0, 0, time.UTC),
+				Task:      "feature-tz",
+				Link:      commitUrl + "e2e2e2e2 \n " + commitUrl + "e3e3e3e3",
+				TimeSpent: 0.5,
+			}},
+		},
+		{
+			name:     "empty day",
+			scenario: "empty_day.json",
+			wantErr:  gitlab.ErrNoGitActions,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			srv := gitlabtest.NewServer(t, gitlabtest.LoadScenario(t, filepath.Join("testdata", "scenarios", tc.scenario)))
+			builder := newBuilder(t, srv)
+
+			user := report.User{Id: 1, GitlabId: 7, UserToken: "token", TimezoneOffset: tc.offset}
+			period := report.UserDay(user, day)
+
+			result, err := builder.Build(context.Background(), user, period)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Build() error = %v, want %v", err, tc.wantErr)
+			}
+
+			if tc.wantErr != nil {
+				return
+			}
+
+			if len(result.Warnings) != 0 {
+				t.Errorf("Build() warnings = %+v, want none", result.Warnings)
+			}
+
+			if !result.PeriodStart.Equal(period.Start) || !result.PeriodEnd.Equal(period.End) {
+				t.Errorf("Build() period = %v - %v, want %v - %v", result.PeriodStart, result.PeriodEnd, period.Start, period.End)
+			}
+
+			source := strings.TrimPrefix(srv.URL, "http://")
+			assertRows(t, result.Rows, tc.wantRows, source)
+		})
+	}
+}
+
+func TestBuildWithoutEvents(t *testing.T) {
+	srv := gitlabtest.NewServer(t, gitlabtest.Scenario{})
+	builder := newBuilder(t, srv)
+
+	user := report.User{Id: 1, GitlabId: 7, UserToken: "token"}
+	_, err := builder.Build(context.Background(), user, report.UserDay(user, time.Now()))
+	if !errors.Is(err, gitlab.ErrNoGitActions) {
+		t.Errorf("Build() error = %v, want %v", err, gitlab.ErrNoGitActions)
+	}
+}
+
+func TestBuildFailsOnRejectedToken(t *testing.T) {
+	srv := gitlabtest.NewServer(t, gitlabtest.LoadScenario(t, filepath.Join("testdata", "scenarios", "single_branch.json")))
+	builder := newBuilder(t, srv)
+
+	// Linked account without a token is rejected by gitlab
+	user := report.User{Id: 1, GitlabId: 7, UserToken: "token"}
+	user.Accounts = []report.Account{{Provider: report.ProviderGitlab, ExternalId: 8}}
+	period := report.UserDay(user, time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC))
+
+	_, err := builder.Build(context.Background(), user, period)
+	if !errors.Is(err, gitlab.ErrUnauthorized) {
+		t.Errorf("Build() error = %v, want %v", err, gitlab.ErrUnauthorized)
+	}
+}
+
+func newBuilder(t *testing.T, srv *gitlabtest.Server) *gitlab.GitlabBuilder {
+	t.Helper()
+
+	client, err := gitlab.NewClient(gitlab.ClientConfig{
+		BaseUrl: srv.BaseUrl(),
+		Retry:   gitlab.RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	return gitlab.NewReportBuilder(*client, 4)
+}
+
+func assertRows(t *testing.T, got []report.ReportRow, want []report.ReportRow, source string) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("Build() returned %d rows, want %d: %+v", len(got), len(want), got)
+	}
+
+	for i := range want {
+		want[i].Source = source
+		if !got[i].Date.Equal(want[i].Date) || got[i].Task != want[i].Task || got[i].Link != want[i].Link ||
+			got[i].TimeSpent != want[i].TimeSpent || got[i].Source != want[i].Source {
+			t.Errorf("row %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/report"
+)
+
+func TestBuildWithoutAccounts(t *testing.T) {
+	builder := NewReportBuilder(GitlabClient{}, 1)
+
+	_, err := builder.Build(context.Background(), report.User{Id: 1}, report.Period{})
+	if !errors.Is(err, ErrNoAccounts) {
+		t.Errorf("Build() error = %v, want %v", err, ErrNoAccounts)
+	}
+}
+
+func TestBuildWarnsAboutMissingCommitLinks(t *testing.T) {
+	period := report.Period{
+		Start: time.Date(2023, 10, 5, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2023, 10, 6, 0, 0, 0, 0, time.UTC),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/users/7/events", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"project_id": 1, "action_name": "pushed to", "created_at": %q,
+			"push_data": {"ref": "feature", "commit_to": "abc"}}]`,
+			period.Start.Add(10*time.Hour).Format(time.RFC3339))
+	})
+	mux.HandleFunc("/api/v4/projects/1/merge_requests", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/api/v4/projects/1/repository/commits/abc", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client, err := NewClient(ClientConfig{BaseUrl: srv.URL + "/api/v4", Retry: testRetryPolicy})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	user := report.User{Id: 1, GitlabId: 7, UserToken: "token"}
+	result, err := NewReportBuilder(*client, 2).Build(context.Background(), user, period)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	if len(result.Rows) != 1 || result.Rows[0].Task != "feature" || result.Rows[0].Link != "" {
+		t.Errorf("Build() rows = %+v, want a single row of branch feature without links", result.Rows)
+	}
+
+	if len(result.Warnings) != 1 || result.Warnings[0].Kind != report.WarningCommitLinksUnavailable ||
+		result.Warnings[0].Task != "feature" {
+		t.Errorf("Build() warnings = %+v, want missing commit links of feature", result.Warnings)
+	}
+}
+
+func TestBuildStopsWhenCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(ClientConfig{BaseUrl: srv.URL, Retry: testRetryPolicy})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	user := report.User{Id: 1, GitlabId: 7, UserToken: "token"}
+	if _, err := NewReportBuilder(*client, 1).Build(ctx, user, report.Period{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Build() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
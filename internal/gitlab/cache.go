@@ -0,0 +1,145 @@
+package gitlab
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/logger"
+	"github.com/BalanceBalls/report-generator/internal/storage"
+)
+
+// Kinds of cached responses, used as metric labels
+const (
+	cacheKindMergeRequest = "merge_request"
+	cacheKindCommit       = "commit"
+	cacheKindCompare      = "compare"
+	cacheKindHistory      = "commit_history"
+	cacheKindBranchMrs    = "branch_merge_requests"
+)
+
+// Results of cache lookups, used as metric labels
+const (
+	cacheHit         = "hit"
+	cacheMiss        = "miss"
+	cacheRevalidated = "revalidated"
+)
+
+// Database keeping cached responses between restarts
+type CacheStore interface {
+	CachedResponse(ctx context.Context, key string) (storage.CachedResponse, error)
+	SaveCachedResponse(ctx context.Context, response storage.CachedResponse) error
+}
+
+// LRU cache of gitlab responses backed by an optional persistent store.
+// Nil cache keeps nothing
+type Cache struct {
+	size int
+	ttl  time.Duration
+	// Consulted when a response is missing in memory
+	store CacheStore
+	now   func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// Keeps up to size responses in memory, a response is used without revalidation during ttl
+func NewCache(size int, ttl time.Duration, store CacheStore) *Cache {
+	return &Cache{
+		size:    size,
+		ttl:     ttl,
+		store:   store,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+// Returns the cached response regardless of its age
+func (c *Cache) Get(ctx context.Context, key string) (storage.CachedResponse, bool) {
+	if c == nil {
+		return storage.CachedResponse{}, false
+	}
+
+	if response, ok := c.getFromMemory(key); ok {
+		return response, true
+	}
+
+	if c.store == nil {
+		return storage.CachedResponse{}, false
+	}
+
+	response, err := c.store.CachedResponse(ctx, key)
+	if err != nil {
+		if !errors.Is(err, storage.ErrCacheMiss) {
+			logger.GetFromContext(ctx).WarnContext(ctx, "could not read cached response", "key", key, "reason", err)
+		}
+
+		return storage.CachedResponse{}, false
+	}
+
+	c.setInMemory(response)
+	return response, true
+}
+
+// Stores the response, failure to persist it is not fatal
+func (c *Cache) Set(ctx context.Context, response storage.CachedResponse) {
+	if c == nil {
+		return
+	}
+
+	if response.StoredAt.IsZero() {
+		response.StoredAt = c.now()
+	}
+
+	c.setInMemory(response)
+
+	if c.store == nil {
+		return
+	}
+
+	if err := c.store.SaveCachedResponse(ctx, response); err != nil {
+		logger.GetFromContext(ctx).WarnContext(ctx, "could not persist cached response", "key", response.Key, "reason", err)
+	}
+}
+
+// Checks whether the response can be used without asking gitlab
+func (c *Cache) IsFresh(response storage.CachedResponse) bool {
+	return c != nil && c.now().Sub(response.StoredAt) < c.ttl
+}
+
+func (c *Cache) getFromMemory(key string) (storage.CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return storage.CachedResponse{}, false
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(storage.CachedResponse), true
+}
+
+func (c *Cache) setInMemory(response storage.CachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[response.Key]; ok {
+		element.Value = response
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[response.Key] = c.order.PushFront(response)
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(storage.CachedResponse).Key)
+	}
+}
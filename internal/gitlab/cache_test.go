@@ -0,0 +1,170 @@
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/report"
+	"github.com/BalanceBalls/report-generator/internal/storage"
+)
+
+type mapCacheStore map[string]storage.CachedResponse
+
+func (s mapCacheStore) CachedResponse(ctx context.Context, key string) (storage.CachedResponse, error) {
+	response, ok := s[key]
+	if !ok {
+		return storage.CachedResponse{}, storage.ErrCacheMiss
+	}
+
+	return response, nil
+}
+
+func (s mapCacheStore) SaveCachedResponse(ctx context.Context, response storage.CachedResponse) error {
+	s[response.Key] = response
+	return nil
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache(2, time.Hour, nil)
+
+	cache.Set(ctx, storage.CachedResponse{Key: "a"})
+	cache.Set(ctx, storage.CachedResponse{Key: "b"})
+	cache.Get(ctx, "a")
+	cache.Set(ctx, storage.CachedResponse{Key: "c"})
+
+	if _, ok := cache.Get(ctx, "b"); ok {
+		t.Error("least recently used response has not been evicted")
+	}
+
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(ctx, key); !ok {
+			t.Errorf("response %q has been evicted", key)
+		}
+	}
+}
+
+func TestCacheExpiresAfterTtl(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC)
+	cache := NewCache(10, time.Hour, nil)
+	cache.now = func() time.Time { return now }
+
+	cache.Set(ctx, storage.CachedResponse{Key: "a"})
+	response, _ := cache.Get(ctx, "a")
+	if !cache.IsFresh(response) {
+		t.Error("IsFresh() = false right after the response has been cached")
+	}
+
+	now = now.Add(time.Hour)
+	if cache.IsFresh(response) {
+		t.Error("IsFresh() = true after ttl has passed")
+	}
+}
+
+func TestCacheFallsBackToStore(t *testing.T) {
+	ctx := context.Background()
+	store := mapCacheStore{}
+
+	NewCache(10, time.Hour, store).Set(ctx, storage.CachedResponse{Key: "a", Body: []byte("body")})
+
+	// Cache of the restarted bot
+	response, ok := NewCache(10, time.Hour, store).Get(ctx, "a")
+	if !ok || string(response.Body) != "body" {
+		t.Errorf("Get() = %+v, %v, want persisted response", response, ok)
+	}
+}
+
+func TestNilCacheKeepsNothing(t *testing.T) {
+	var cache *Cache
+	cache.Set(context.Background(), storage.CachedResponse{Key: "a"})
+
+	if _, ok := cache.Get(context.Background(), "a"); ok {
+		t.Error("nil cache returned a response")
+	}
+}
+
+func newCachingClient(t *testing.T, handler http.HandlerFunc) *GitlabClient {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client, err := NewClient(ClientConfig{
+		BaseUrl: srv.URL + "/api/v4",
+		Retry:   testRetryPolicy,
+		Cache:   NewCache(10, time.Hour, nil),
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	return client
+}
+
+func TestCommitsAreFetchedOnce(t *testing.T) {
+	var calls atomic.Int32
+	client := newCachingClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"id": "abc", "title": "fix"}`))
+	})
+
+	account := report.Account{Token: "token"}
+	for i := 0; i < 3; i++ {
+		commit, err := client.Commit(context.Background(), account, 1, "abc")
+		if err != nil {
+			t.Fatalf("Commit() error = %v", err)
+		}
+
+		if commit.Title != "fix" {
+			t.Errorf("Commit() title = %q, want %q", commit.Title, "fix")
+		}
+	}
+
+	if calls.Load() != 1 {
+		t.Errorf("gitlab has been called %d times, want 1", calls.Load())
+	}
+}
+
+func TestMergeRequestsAreRevalidated(t *testing.T) {
+	const etag = `W/"v1"`
+
+	var calls, notModified atomic.Int32
+	client := newCachingClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(`{"iid": 5, "title": "feature"}`))
+	})
+
+	now := time.Now()
+	client.cache.now = func() time.Time { return now }
+	account := report.Account{Token: "token"}
+
+	for i := 0; i < 3; i++ {
+		mr, err := client.MergeRequest(context.Background(), account, 1, 5)
+		if err != nil {
+			t.Fatalf("MergeRequest() error = %v", err)
+		}
+
+		if mr.Title != "feature" {
+			t.Errorf("MergeRequest() title = %q, want %q", mr.Title, "feature")
+		}
+
+		// Every lookup after the first one finds an outdated response
+		now = now.Add(2 * time.Hour)
+	}
+
+	if calls.Load() != 3 || notModified.Load() != 2 {
+		t.Errorf("gitlab has been called %d times with %d revalidations, want 3 with 2", calls.Load(), notModified.Load())
+	}
+}
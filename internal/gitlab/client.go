@@ -3,6 +3,7 @@ package gitlab
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,15 +13,29 @@ import (
 	"time"
 
 	"github.com/BalanceBalls/report-generator/internal/logger"
+	"github.com/BalanceBalls/report-generator/internal/metrics"
 	"github.com/BalanceBalls/report-generator/internal/report"
+	"github.com/BalanceBalls/report-generator/internal/storage"
 )
 
 const tokenHeaderKey = "PRIVATE-TOKEN"
 
+// Gitlab does not return more items per page
+const maxPerPage = 100
+
 type GitlabClient struct {
-	host     string
-	basePath string
-	client   http.Client
+	baseUrl url.URL
+	client  *http.Client
+	retry   RetryPolicy
+	limiter *HostLimiter
+	cache   *Cache
+}
+
+type response struct {
+	body []byte
+	etag string
+	// Gitlab confirmed the cached response is still valid, body is empty
+	notModified bool
 }
 
 type EventsResponse struct {
@@ -28,28 +43,40 @@ type EventsResponse struct {
 	Err    error
 }
 
-func NewClient(host string, basePath string) *GitlabClient {
-	return &GitlabClient{
-		host:     host,
-		basePath: basePath,
-		client:   http.Client{},
+func NewClient(cfg ClientConfig) (*GitlabClient, error) {
+	baseUrl, err := parseBaseUrl(cfg.BaseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newHttpClient(cfg)
+	if err != nil {
+		return nil, err
 	}
+
+	return &GitlabClient{
+		baseUrl: *baseUrl,
+		client:  client,
+		retry:   cfg.Retry,
+		limiter: NewHostLimiter(cfg.RateLimit, cfg.RateBurst),
+		cache:   cfg.Cache,
+	}, nil
 }
 
-func (gc *GitlabClient) Events(ctx context.Context, user report.User, before time.Time, after time.Time) ([]Event, error) {
+func (gc *GitlabClient) Events(ctx context.Context, account report.Account, before time.Time, after time.Time) ([]Event, error) {
 	logger := logger.GetFromContext(ctx)
-	path := path.Join("users", fmt.Sprint(user.GitlabId), "events")
+	path := path.Join("users", fmt.Sprint(account.ExternalId), "events")
 	params := url.Values{}
 
 	if !after.IsZero() {
-		params.Add("after", after.String())
+		params.Add("after", after.Format(time.DateOnly))
 	}
 
 	if !before.IsZero() {
-		params.Add("before", before.String())
+		params.Add("before", before.Format(time.DateOnly))
 	}
 
-	eventsData, err := gc.doRequest(ctx, user.UserToken, path, params)
+	eventsData, err := gc.doRequest(ctx, account, path, params)
 
 	if err != nil {
 		logger.ErrorContext(ctx, "request failed", "error", err)
@@ -65,11 +92,54 @@ func (gc *GitlabClient) Events(ctx context.Context, user report.User, before tim
 	return resData, nil
 }
 
-func (gc *GitlabClient) MergeRequest(ctx context.Context, user report.User, projectId int, mrId int) (*MergeRequest, error) {
+// Returns the user the account's token belongs to
+func (gc *GitlabClient) CurrentUser(ctx context.Context, account report.Account) (*User, error) {
+	logger := logger.GetFromContext(ctx)
+
+	res, err := gc.doRequest(ctx, account, "user", nil)
+
+	if err != nil {
+		logger.ErrorContext(ctx, "request failed", "error", err)
+		return nil, fmt.Errorf("User get request failed: %w", err)
+	}
+
+	var resData User
+	if err = json.Unmarshal(res, &resData); err != nil {
+		logger.ErrorContext(ctx, "response parsing failed", "error", err)
+		return nil, fmt.Errorf("Could not parse response data: %w", err)
+	}
+
+	return &resData, nil
+}
+
+// Returns info about the account's token itself
+func (gc *GitlabClient) TokenInfo(ctx context.Context, account report.Account) (*PersonalAccessToken, error) {
+	logger := logger.GetFromContext(ctx)
+	path := path.Join("personal_access_tokens", "self")
+
+	res, err := gc.doRequest(ctx, account, path, nil)
+
+	if err != nil {
+		logger.ErrorContext(ctx, "request failed", "error", err)
+		return nil, fmt.Errorf("PersonalAccessToken get request failed: %w", err)
+	}
+
+	var resData PersonalAccessToken
+	if err = json.Unmarshal(res, &resData); err != nil {
+		logger.ErrorContext(ctx, "response parsing failed", "error", err)
+		return nil, fmt.Errorf("Could not parse response data: %w", err)
+	}
+
+	return &resData, nil
+}
+
+func (gc *GitlabClient) MergeRequest(ctx context.Context, account report.Account, projectId int, mrId int) (*MergeRequest, error) {
 	logger := logger.GetFromContext(ctx)
 	path := path.Join("projects", strconv.Itoa(projectId), "merge_requests", strconv.Itoa(mrId))
+	key := fmt.Sprintf("%s/%s/%d/%d", cacheKindMergeRequest, gc.Host(account), projectId, mrId)
 
-	res, err := gc.doRequest(ctx, user.UserToken, path, nil)
+	// Merge requests change until they are merged or closed, so they are revalidated after ttl
+	res, err := gc.cachedRequest(ctx, account, cacheKindMergeRequest, key, path, nil, false)
 
 	if err != nil {
 		logger.ErrorContext(ctx, "request failed", "error", err)
@@ -85,11 +155,40 @@ func (gc *GitlabClient) MergeRequest(ctx context.Context, user report.User, proj
 	return &resData, nil
 }
 
-func (gc *GitlabClient) Commit(ctx context.Context, user report.User, projectId int, cHash string) (*Commit, error) {
+// Returns merge requests of the project made from the branch, the newest first
+func (gc *GitlabClient) BranchMergeRequests(
+	ctx context.Context, account report.Account, projectId int, branch string) ([]MergeRequest, error) {
+	logger := logger.GetFromContext(ctx)
+	path := path.Join("projects", strconv.Itoa(projectId), "merge_requests")
+	key := fmt.Sprintf("%s/%s/%d/%s", cacheKindBranchMrs, gc.Host(account), projectId, branch)
+
+	params := url.Values{}
+	params.Add("source_branch", branch)
+
+	// New merge requests may be opened from the branch, so they are revalidated after ttl
+	res, err := gc.cachedRequest(ctx, account, cacheKindBranchMrs, key, path, params, false)
+
+	if err != nil {
+		logger.ErrorContext(ctx, "request failed", "error", err)
+		return nil, fmt.Errorf("MergeRequests get request failed: %w", err)
+	}
+
+	var resData []MergeRequest
+	if err = json.Unmarshal(res, &resData); err != nil {
+		logger.ErrorContext(ctx, "response parsing failed", "error", err)
+		return nil, fmt.Errorf("Could not parse response data: %w", err)
+	}
+
+	return resData, nil
+}
+
+func (gc *GitlabClient) Commit(ctx context.Context, account report.Account, projectId int, cHash string) (*Commit, error) {
 	logger := logger.GetFromContext(ctx)
 	path := path.Join("projects", strconv.Itoa(projectId), "repository", "commits", cHash)
+	key := fmt.Sprintf("%s/%s/%d/%s", cacheKindCommit, gc.Host(account), projectId, cHash)
 
-	res, err := gc.doRequest(ctx, user.UserToken, path, nil)
+	// Commits never change once pushed
+	res, err := gc.cachedRequest(ctx, account, cacheKindCommit, key, path, nil, true)
 
 	if err != nil {
 		logger.ErrorContext(ctx, "request failed", "error", err)
@@ -105,37 +204,245 @@ func (gc *GitlabClient) Commit(ctx context.Context, user report.User, projectId
 	return &resData, nil
 }
 
-func (gc *GitlabClient) doRequest(ctx context.Context, token string, endpointPath string, params url.Values) ([]byte, error) {
+// Returns commits made after the from commit up to the to one, the oldest first
+func (gc *GitlabClient) CompareCommits(
+	ctx context.Context, account report.Account, projectId int, from string, to string) ([]Commit, error) {
 	logger := logger.GetFromContext(ctx)
-	u := url.URL{
-		Scheme: "https",
-		Host:   gc.host,
-		Path:   path.Join(gc.basePath, endpointPath),
+	path := path.Join("projects", strconv.Itoa(projectId), "repository", "compare")
+	key := fmt.Sprintf("%s/%s/%d/%s..%s", cacheKindCompare, gc.Host(account), projectId, from, to)
+
+	params := url.Values{}
+	params.Add("from", from)
+	params.Add("to", to)
+
+	// Commits between two hashes never change
+	res, err := gc.cachedRequest(ctx, account, cacheKindCompare, key, path, params, true)
+
+	if err != nil {
+		logger.ErrorContext(ctx, "request failed", "error", err)
+		return nil, fmt.Errorf("Compare get request failed: %w", err)
+	}
+
+	var resData Compare
+	if err = json.Unmarshal(res, &resData); err != nil {
+		logger.ErrorContext(ctx, "response parsing failed", "error", err)
+		return nil, fmt.Errorf("Could not parse response data: %w", err)
+	}
+
+	return resData.Commits, nil
+}
+
+// Returns up to count commits reachable from the commit, the newest first.
+// Pages are fetched until count commits are collected or the history ends
+func (gc *GitlabClient) CommitHistory(
+	ctx context.Context, account report.Account, projectId int, cHash string, count int) ([]Commit, error) {
+	logger := logger.GetFromContext(ctx)
+	path := path.Join("projects", strconv.Itoa(projectId), "repository", "commits")
+	perPage := min(count, maxPerPage)
+
+	var commits []Commit
+	for page := 1; len(commits) < count; page++ {
+		key := fmt.Sprintf("%s/%s/%d/%s~%d/%d", cacheKindHistory, gc.Host(account), projectId, cHash, perPage, page)
+
+		params := url.Values{}
+		params.Add("ref_name", cHash)
+		params.Add("per_page", strconv.Itoa(perPage))
+		// The first page is returned by default
+		if page > 1 {
+			params.Add("page", strconv.Itoa(page))
+		}
+
+		// History of a commit never changes
+		res, err := gc.cachedRequest(ctx, account, cacheKindHistory, key, path, params, true)
+
+		if err != nil {
+			logger.ErrorContext(ctx, "request failed", "error", err, "page", page)
+			return nil, fmt.Errorf("Commits get request failed: %w", err)
+		}
+
+		var resData []Commit
+		if err = json.Unmarshal(res, &resData); err != nil {
+			logger.ErrorContext(ctx, "response parsing failed", "error", err)
+			return nil, fmt.Errorf("Could not parse response data: %w", err)
+		}
+
+		commits = append(commits, resData...)
+		if len(resData) < perPage {
+			break
+		}
+	}
+
+	if len(commits) > count {
+		commits = commits[:count]
+	}
+
+	return commits, nil
+}
+
+// Returns the host requests for the account are sent to.
+// Accounts of other hosts share scheme and API path of the base url
+func (gc *GitlabClient) Host(account report.Account) string {
+	if account.Host != "" {
+		return account.Host
+	}
+
+	return gc.baseUrl.Host
+}
+
+// Returns the cached response while it is fresh, otherwise fetches it revalidating with the ETag.
+// Responses are shared by users of the same host, who could only learn the ids from their own events
+func (gc *GitlabClient) cachedRequest(
+	ctx context.Context, account report.Account, kind string, key string, endpointPath string, params url.Values, immutable bool,
+) ([]byte, error) {
+	if gc.cache == nil {
+		return gc.doRequest(ctx, account, endpointPath, params)
+	}
+
+	cached, found := gc.cache.Get(ctx, key)
+	if found && (immutable || gc.cache.IsFresh(cached)) {
+		metrics.GitlabCacheRequests.Inc(kind, cacheHit)
+		// Recordings have to contain responses served from cache as well
+		record(ctx, http.MethodGet, gc.requestUrl(account, endpointPath, params), http.StatusOK, cached.Body)
+		return cached.Body, nil
+	}
+
+	etag := ""
+	if found {
+		etag = cached.ETag
+	}
+
+	res, err := gc.doConditionalRequest(ctx, account, endpointPath, params, etag)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.notModified {
+		metrics.GitlabCacheRequests.Inc(kind, cacheRevalidated)
+		record(ctx, http.MethodGet, gc.requestUrl(account, endpointPath, params), http.StatusOK, cached.Body)
+		cached.StoredAt = time.Time{}
+		gc.cache.Set(ctx, cached)
+		return cached.Body, nil
 	}
 
+	metrics.GitlabCacheRequests.Inc(kind, cacheMiss)
+	gc.cache.Set(ctx, storage.CachedResponse{Key: key, Body: res.body, ETag: res.etag})
+
+	return res.body, nil
+}
+
+func (gc *GitlabClient) doRequest(ctx context.Context, account report.Account, endpointPath string, params url.Values) ([]byte, error) {
+	res, err := gc.doConditionalRequest(ctx, account, endpointPath, params, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return res.body, nil
+}
+
+// Sends GET request retrying temporary failures, every attempt waits for the host's rate limiter.
+// Gitlab may respond that the response with the ETag has not changed when it is set
+func (gc *GitlabClient) doConditionalRequest(
+	ctx context.Context, account report.Account, endpointPath string, params url.Values, etag string) (*response, error) {
+	logger := logger.GetFromContext(ctx)
+	u := gc.requestUrl(account, endpointPath, params)
+
+	for attempt := 0; ; attempt++ {
+		if err := gc.limiter.Wait(ctx, u.Host); err != nil {
+			return nil, fmt.Errorf("Failed to wait for gitlab rate limit: %w", err)
+		}
+
+		res, err := gc.attempt(ctx, account, u, endpointPath, etag)
+		if err == nil {
+			if !res.notModified {
+				record(ctx, http.MethodGet, u, http.StatusOK, res.body)
+			}
+			return res, nil
+		}
+
+		delay, retry := gc.retry.next(ctx, attempt, err)
+		if !retry {
+			var statusErr *StatusError
+			if errors.As(err, &statusErr) {
+				record(ctx, http.MethodGet, u, statusErr.StatusCode, nil)
+			}
+			return nil, err
+		}
+
+		logger.WarnContext(ctx, "gitlab request failed, retrying",
+			"endpoint", endpointPath, "attempt", attempt+1, "delay", delay, "reason", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("Gitlab request cancelled: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+func (gc *GitlabClient) requestUrl(account report.Account, endpointPath string, params url.Values) url.URL {
+	u := gc.baseUrl
+	u.Host = gc.Host(account)
+	u.Path = path.Join(u.Path, endpointPath)
+	u.RawPath = ""
+
+	if params != nil {
+		u.RawQuery = params.Encode()
+	}
+
+	return u
+}
+
+func (gc *GitlabClient) attempt(ctx context.Context, account report.Account, u url.URL, endpointPath string, etag string) (*response, error) {
+	logger := logger.GetFromContext(ctx)
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("Could not construct request: %w", err)
 	}
 
-	req.Header.Set(tokenHeaderKey, token)
-	if params != nil {
-		req.URL.RawQuery = params.Encode()
+	req.Header.Set(tokenHeaderKey, account.Token)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
 	}
 
+	startedAt := time.Now()
 	res, err := gc.client.Do(req)
 
 	if err != nil {
+		metrics.GitlabRequestDuration.Observe(time.Since(startedAt).Seconds(), u.Host, "error")
 		logger.ErrorContext(ctx, "http request failed", "error", err)
 		return nil, fmt.Errorf("Failed to query gitlab api (%q) : %w", endpointPath, err)
 	}
+	defer res.Body.Close()
+
+	metrics.GitlabRequestDuration.Observe(time.Since(startedAt).Seconds(), u.Host, strconv.Itoa(res.StatusCode))
 
 	logger.InfoContext(ctx, "http request finished",
 		"request_url", res.Request.URL.String(),
 		"status_code", res.StatusCode)
 
+	now := time.Now()
+	gc.limiter.Observe(u.Host, res.Header, now)
+
 	if res.StatusCode >= 400 {
-		return nil, fmt.Errorf("response status code does not indicate success: %d", res.StatusCode)
+		statusErr := &StatusError{
+			StatusCode: res.StatusCode,
+			Endpoint:   endpointPath,
+			RetryAfter: parseRetryAfter(res.Header, now),
+		}
+
+		// Other users of the host have to wait as well
+		if res.StatusCode == http.StatusTooManyRequests && statusErr.RetryAfter > 0 {
+			gc.limiter.Pause(u.Host, now.Add(statusErr.RetryAfter))
+		}
+
+		return nil, statusErr
+	}
+
+	if res.StatusCode == http.StatusNotModified {
+		return &response{etag: etag, notModified: true}, nil
 	}
 
 	resBody, err := io.ReadAll(res.Body)
@@ -145,5 +452,5 @@ func (gc *GitlabClient) doRequest(ctx context.Context, token string, endpointPat
 		return nil, fmt.Errorf("Failed to read response body: %w", err)
 	}
 
-	return resBody, nil
+	return &response{body: resBody, etag: res.Header.Get("ETag")}, nil
 }
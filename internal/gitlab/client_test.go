@@ -0,0 +1,288 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/gitlab/gitlabtest"
+	"github.com/BalanceBalls/report-generator/internal/report"
+)
+
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+// Responds with the statuses in turn, the last one is repeated
+func newTestClient(t *testing.T, statuses []int, header http.Header) (*GitlabClient, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(calls.Add(1)) - 1
+		status := statuses[len(statuses)-1]
+		if call < len(statuses) {
+			status = statuses[call]
+		}
+
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+
+		w.WriteHeader(status)
+		w.Write([]byte(`{"id": 42, "username": "user"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := NewClient(ClientConfig{
+		BaseUrl: srv.URL + "/api/v4",
+		CaFile:  writeCaFile(t, srv),
+		Retry:   testRetryPolicy,
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	return client, &calls
+}
+
+// Writes certificate of the test server to a PEM bundle
+func writeCaFile(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, bundle, 0o600); err != nil {
+		t.Fatalf("could not write CA bundle: %v", err)
+	}
+
+	return caFile
+}
+
+func TestPlainHttpBaseUrl(t *testing.T) {
+	var requestPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestPath = r.URL.Path
+		w.Write([]byte(`{"id": 42, "username": "user"}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(ClientConfig{BaseUrl: srv.URL + "/gitlab/api/v4", Retry: testRetryPolicy})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if _, err := client.CurrentUser(context.Background(), report.Account{Token: "token"}); err != nil {
+		t.Fatalf("CurrentUser() error = %v", err)
+	}
+
+	if requestPath != "/gitlab/api/v4/user" {
+		t.Errorf("gitlab has been requested at %q, want %q", requestPath, "/gitlab/api/v4/user")
+	}
+}
+
+func TestRejectsUntrustedCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 42, "username": "user"}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(ClientConfig{BaseUrl: srv.URL, Retry: RetryPolicy{MaxAttempts: 1}})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if _, err := client.CurrentUser(context.Background(), report.Account{Token: "token"}); err == nil {
+		t.Error("CurrentUser() succeeded with certificate signed by unknown CA")
+	}
+}
+
+func TestNewClientValidatesConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ClientConfig
+	}{
+		{"no scheme", ClientConfig{BaseUrl: "gitlab.com/api/v4"}},
+		{"unsupported scheme", ClientConfig{BaseUrl: "ftp://gitlab.com/api/v4"}},
+		{"missing CA bundle", ClientConfig{BaseUrl: "https://gitlab.com", CaFile: "missing.pem"}},
+		{"key without certificate", ClientConfig{BaseUrl: "https://gitlab.com", ClientKeyFile: "client.key"}},
+		{"invalid proxy", ClientConfig{BaseUrl: "https://gitlab.com", ProxyUrl: "://proxy"}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewClient(tc.cfg); err == nil {
+				t.Errorf("NewClient(%+v) succeeded, want error", tc.cfg)
+			}
+		})
+	}
+}
+
+func TestRetriesTemporaryFailures(t *testing.T) {
+	client, calls := newTestClient(t, []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}, nil)
+
+	user, err := client.CurrentUser(context.Background(), report.Account{Token: "token"})
+	if err != nil {
+		t.Fatalf("CurrentUser() error = %v", err)
+	}
+
+	if user.Id != 42 || calls.Load() != 3 {
+		t.Errorf("CurrentUser() = %+v after %d calls, want user 42 after 3 calls", user, calls.Load())
+	}
+}
+
+func TestStopsRetryingAfterMaxAttempts(t *testing.T) {
+	client, calls := newTestClient(t, []int{http.StatusBadGateway}, nil)
+
+	_, err := client.CurrentUser(context.Background(), report.Account{Token: "token"})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("CurrentUser() error = %v, want %v", err, ErrUnavailable)
+	}
+
+	if calls.Load() != int32(testRetryPolicy.MaxAttempts) {
+		t.Errorf("gitlab has been called %d times, want %d", calls.Load(), testRetryPolicy.MaxAttempts)
+	}
+}
+
+func TestDoesNotRetryClientErrors(t *testing.T) {
+	tests := []struct {
+		status  int
+		wantErr error
+	}{
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusForbidden, ErrForbidden},
+		{http.StatusNotFound, ErrNotFound},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(http.StatusText(tc.status), func(t *testing.T) {
+			client, calls := newTestClient(t, []int{tc.status}, nil)
+
+			_, err := client.CurrentUser(context.Background(), report.Account{Token: "token"})
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("CurrentUser() error = %v, want %v", err, tc.wantErr)
+			}
+
+			if calls.Load() != 1 {
+				t.Errorf("gitlab has been called %d times, want 1", calls.Load())
+			}
+		})
+	}
+}
+
+func TestHonoursRetryAfter(t *testing.T) {
+	header := http.Header{"Retry-After": []string{"60"}}
+	client, calls := newTestClient(t, []int{http.StatusTooManyRequests}, header)
+
+	// Gitlab asks to wait longer than the retry policy allows
+	_, err := client.CurrentUser(context.Background(), report.Account{Token: "token"})
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("CurrentUser() error = %v, want %v", err, ErrRateLimited)
+	}
+
+	if calls.Load() != 1 {
+		t.Errorf("gitlab has been called %d times, want 1", calls.Load())
+	}
+
+	// Other requests to the host wait for the rate limit to reset
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.CurrentUser(ctx, report.Account{Token: "other"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CurrentUser() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if calls.Load() != 1 {
+		t.Errorf("gitlab has been called %d times while rate limited, want 1", calls.Load())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"30", 30 * time.Second},
+		{"Thu, 05 Oct 2023 12:01:00 GMT", time.Minute},
+		{"Thu, 05 Oct 2023 11:00:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, tc := range tests {
+		header := http.Header{}
+		header.Set("Retry-After", tc.value)
+
+		if got := parseRetryAfter(header, now); got != tc.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tc.value, got, tc.want)
+		}
+	}
+}
+
+// Builds a linear history of the given length, commit i has commit i-1 as parent
+func linearHistory(length int) gitlabtest.Scenario {
+	scenario := gitlabtest.Scenario{Commits: map[string]json.RawMessage{}}
+	for i := 1; i <= length; i++ {
+		commit := fmt.Sprintf(`{"id": "c%d", "parent_ids": ["c%d"]}`, i, i-1)
+		scenario.Commits[fmt.Sprintf("1/c%d", i)] = json.RawMessage(commit)
+	}
+
+	return scenario
+}
+
+func TestCommitHistoryIsPaginated(t *testing.T) {
+	tests := []struct {
+		name     string
+		length   int
+		count    int
+		want     int
+		requests int
+	}{
+		{name: "single page", length: 50, count: 30, want: 30, requests: 1},
+		{name: "several pages", length: 250, count: 230, want: 230, requests: 3},
+		{name: "history shorter than count", length: 150, count: 230, want: 150, requests: 2},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			srv := gitlabtest.NewServer(t, linearHistory(tc.length))
+			client, err := NewClient(ClientConfig{BaseUrl: srv.BaseUrl(), Retry: testRetryPolicy})
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			head := fmt.Sprintf("c%d", tc.length)
+			commits, err := client.CommitHistory(context.Background(), report.Account{Token: "token"}, 1, head, tc.count)
+			if err != nil {
+				t.Fatalf("CommitHistory() error = %v", err)
+			}
+
+			if len(commits) != tc.want {
+				t.Fatalf("CommitHistory() returned %d commits, want %d", len(commits), tc.want)
+			}
+
+			// Newest first without gaps between pages
+			for i, commit := range commits {
+				if want := fmt.Sprintf("c%d", tc.length-i); commit.Id != want {
+					t.Fatalf("CommitHistory()[%d] = %s, want %s", i, commit.Id, want)
+				}
+			}
+
+			if got := len(srv.Requests()); got != tc.requests {
+				t.Errorf("gitlab has been called %d times, want %d", got, tc.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package gitlab
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Failed responses of gitlab API, match them with errors.Is
+var (
+	ErrUnauthorized = errors.New("gitlab token is invalid, expired or revoked")
+	ErrForbidden    = errors.New("gitlab token has no access to the resource")
+	ErrNotFound     = errors.New("gitlab resource has not been found")
+	ErrRateLimited  = errors.New("gitlab rate limit has been exceeded")
+	ErrUnavailable  = errors.New("gitlab is temporarily unavailable")
+)
+
+// Response of gitlab API with unsuccessful status code
+type StatusError struct {
+	StatusCode int
+	Endpoint   string
+	// Delay requested by gitlab before the next attempt, zero if unknown
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("gitlab responded to %q with status code %d", e.Endpoint, e.StatusCode)
+}
+
+// Makes the error match the sentinel errors of its status code
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrUnavailable:
+		return isUnavailableStatus(e.StatusCode)
+	}
+
+	return false
+}
+
+// Attempt may succeed later for these statuses
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || isUnavailableStatus(e.StatusCode)
+}
+
+func isUnavailableStatus(statusCode int) bool {
+	return statusCode == http.StatusBadGateway ||
+		statusCode == http.StatusServiceUnavailable ||
+		statusCode == http.StatusGatewayTimeout
+}
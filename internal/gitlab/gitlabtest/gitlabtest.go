@@ -0,0 +1,295 @@
+// Package gitlabtest provides a fake gitlab API server
+// serving events, merge requests and commits of a scenario.
+// Compares and commit histories follow the first of the commits' parent_ids
+package gitlabtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Path the API is served at, append it to the server url to get the client's base url
+const ApiPath = "/api/v4"
+
+// Gitlab data served by the fake server. Responses are kept as raw JSON,
+// so fixtures look exactly like responses of the real API
+type Scenario struct {
+	// Events by gitlab user id
+	Events map[string][]json.RawMessage `json:"events"`
+	// Merge requests by "<project id>/<iid>"
+	MergeRequests map[string]json.RawMessage `json:"merge_requests"`
+	// Commits by "<project id>/<sha>"
+	Commits map[string]json.RawMessage `json:"commits"`
+}
+
+// Reads the scenario from a JSON fixture
+func LoadScenario(t *testing.T, path string) Scenario {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read scenario: %v", err)
+	}
+
+	var scenario Scenario
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		t.Fatalf("could not parse scenario %s: %v", path, err)
+	}
+
+	return scenario
+}
+
+type Server struct {
+	*httptest.Server
+	scenario Scenario
+
+	mu       sync.Mutex
+	requests []string
+}
+
+// Starts the server, it is closed when the test finishes
+func NewServer(t *testing.T, scenario Scenario) *Server {
+	t.Helper()
+
+	s := &Server{scenario: scenario}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Url the gitlab client has to be configured with
+func (s *Server) BaseUrl() string {
+	return s.URL + ApiPath
+}
+
+// Paths of requests received so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.URL.Path)
+	s.mu.Unlock()
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Header.Get("PRIVATE-TOKEN") == "" {
+		writeJSON(w, http.StatusUnauthorized, json.RawMessage(`{"message": "401 Unauthorized"}`))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, ApiPath), "/"), "/")
+
+	switch {
+	// users/:id/events
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "events":
+		s.serveEvents(w, r, parts[1])
+	// projects/:id/merge_requests?source_branch=:branch
+	case len(parts) == 3 && parts[0] == "projects" && parts[2] == "merge_requests":
+		s.serveBranchMergeRequests(w, r, parts[1])
+	// projects/:id/merge_requests/:iid
+	case len(parts) == 4 && parts[0] == "projects" && parts[2] == "merge_requests":
+		serveFound(w, s.scenario.MergeRequests, parts[1]+"/"+parts[3])
+	// projects/:id/repository/commits/:sha
+	case len(parts) == 5 && parts[0] == "projects" && parts[2] == "repository" && parts[3] == "commits":
+		serveFound(w, s.scenario.Commits, parts[1]+"/"+parts[4])
+	// projects/:id/repository/commits?ref_name=:sha
+	case len(parts) == 4 && parts[0] == "projects" && parts[2] == "repository" && parts[3] == "commits":
+		s.serveHistory(w, r, parts[1])
+	// projects/:id/repository/compare?from=:sha&to=:sha
+	case len(parts) == 4 && parts[0] == "projects" && parts[2] == "repository" && parts[3] == "compare":
+		s.serveCompare(w, r, parts[1])
+	default:
+		writeJSON(w, http.StatusNotFound, json.RawMessage(`{"error": "404 Not Found"}`))
+	}
+}
+
+// Filters events the way gitlab does: both dates are exclusive and compared in UTC
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request, userId string) {
+	if _, err := strconv.Atoi(userId); err != nil {
+		writeJSON(w, http.StatusNotFound, json.RawMessage(`{"message": "404 User Not Found"}`))
+		return
+	}
+
+	after, err := parseDate(r.URL.Query().Get("after"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, json.RawMessage(`{"error": "after is invalid"}`))
+		return
+	}
+
+	before, err := parseDate(r.URL.Query().Get("before"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, json.RawMessage(`{"error": "before is invalid"}`))
+		return
+	}
+
+	result := []json.RawMessage{}
+	for _, event := range s.scenario.Events[userId] {
+		var header struct {
+			CreatedAt time.Time `json:"created_at"`
+		}
+		if err := json.Unmarshal(event, &header); err != nil {
+			writeJSON(w, http.StatusInternalServerError, json.RawMessage(fmt.Sprintf(`{"error": %q}`, err)))
+			return
+		}
+
+		if !after.IsZero() && header.CreatedAt.Before(after.AddDate(0, 0, 1)) {
+			continue
+		}
+
+		if !before.IsZero() && !header.CreatedAt.Before(before) {
+			continue
+		}
+
+		result = append(result, event)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Serves merge requests of the project made from source_branch, the newest first
+func (s *Server) serveBranchMergeRequests(w http.ResponseWriter, r *http.Request, projectId string) {
+	branch := r.URL.Query().Get("source_branch")
+
+	type found struct {
+		iid  int
+		data json.RawMessage
+	}
+	var mergeRequests []found
+
+	for key, mr := range s.scenario.MergeRequests {
+		if !strings.HasPrefix(key, projectId+"/") {
+			continue
+		}
+
+		var header struct {
+			Iid          int    `json:"iid"`
+			SourceBranch string `json:"source_branch"`
+		}
+		if err := json.Unmarshal(mr, &header); err != nil {
+			writeJSON(w, http.StatusInternalServerError, json.RawMessage(fmt.Sprintf(`{"error": %q}`, err)))
+			return
+		}
+
+		if branch == "" || header.SourceBranch == branch {
+			mergeRequests = append(mergeRequests, found{iid: header.Iid, data: mr})
+		}
+	}
+
+	sort.Slice(mergeRequests, func(i, j int) bool {
+		return mergeRequests[i].iid > mergeRequests[j].iid
+	})
+
+	result := []json.RawMessage{}
+	for _, mr := range mergeRequests {
+		result = append(result, mr.data)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Serves a page of commits reachable from ref_name, the newest first.
+// Pages are limited to 100 commits like gitlab does
+func (s *Server) serveHistory(w http.ResponseWriter, r *http.Request, projectId string) {
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil {
+		perPage = 20
+	}
+	perPage = min(perPage, 100)
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	history, ok := s.history(projectId, r.URL.Query().Get("ref_name"), "", page*perPage)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, json.RawMessage(`{"message": "404 Not found"}`))
+		return
+	}
+
+	skip := min((page-1)*perPage, len(history))
+	writeJSON(w, http.StatusOK, history[skip:])
+}
+
+// Serves commits made after from up to to, the oldest first
+func (s *Server) serveCompare(w http.ResponseWriter, r *http.Request, projectId string) {
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+
+	history, ok := s.history(projectId, to, from, -1)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, json.RawMessage(`{"message": "404 Not found"}`))
+		return
+	}
+
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"commits": history})
+}
+
+// Walks first parents from the commit until the stop one or the limit.
+// Reports false when the commit itself is unknown
+func (s *Server) history(projectId string, sha string, stop string, limit int) ([]json.RawMessage, bool) {
+	result := []json.RawMessage{}
+
+	for sha != "" && sha != stop && len(result) != limit {
+		commit, ok := s.scenario.Commits[projectId+"/"+sha]
+		if !ok {
+			break
+		}
+		result = append(result, commit)
+
+		var header struct {
+			ParentIds []string `json:"parent_ids"`
+		}
+		if err := json.Unmarshal(commit, &header); err != nil || len(header.ParentIds) == 0 {
+			break
+		}
+		sha = header.ParentIds[0]
+	}
+
+	return result, len(result) > 0
+}
+
+func serveFound(w http.ResponseWriter, responses map[string]json.RawMessage, key string) {
+	response, ok := responses[key]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, json.RawMessage(`{"message": "404 Not found"}`))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.DateOnly, value)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
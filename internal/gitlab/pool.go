@@ -0,0 +1,62 @@
+package gitlab
+
+import (
+	"context"
+	"sync"
+)
+
+// Calls fn for every index in [0, n) using at most workers goroutines.
+// The first error cancels the context passed to the rest of the calls and is returned.
+// Results are expected to be written by index, so their order does not depend on scheduling
+func forEach(ctx context.Context, workers int, n int, fn func(ctx context.Context, i int) error) error {
+	if workers <= 0 || workers > n {
+		workers = n
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indexes := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				if err := fn(ctx, i); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	// Remaining indexes are not handed out once the context is done
+	func() {
+		defer close(indexes)
+
+		for i := 0; i < n; i++ {
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	// Parent context has been cancelled before all calls were made
+	return ctx.Err()
+}
@@ -0,0 +1,91 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachLimitsWorkers(t *testing.T) {
+	const workers = 3
+
+	var running, maxRunning atomic.Int32
+	results := make([]int, 20)
+
+	err := forEach(context.Background(), workers, len(results), func(ctx context.Context, i int) error {
+		current := running.Add(1)
+		defer running.Add(-1)
+
+		for {
+			observed := maxRunning.Load()
+			if current <= observed || maxRunning.CompareAndSwap(observed, current) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond)
+		results[i] = i * i
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("forEach() error = %v", err)
+	}
+
+	if maxRunning.Load() > workers {
+		t.Errorf("%d calls ran concurrently, want at most %d", maxRunning.Load(), workers)
+	}
+
+	for i, result := range results {
+		if result != i*i {
+			t.Errorf("results[%d] = %d, want %d", i, result, i*i)
+		}
+	}
+}
+
+func TestForEachCancelsOnFirstError(t *testing.T) {
+	errFatal := errors.New("fatal")
+
+	var calls atomic.Int32
+	err := forEach(context.Background(), 2, 100, func(ctx context.Context, i int) error {
+		calls.Add(1)
+		if i == 0 {
+			return errFatal
+		}
+
+		// Other calls wait for the cancellation
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	})
+
+	if !errors.Is(err, errFatal) {
+		t.Errorf("forEach() error = %v, want %v", err, errFatal)
+	}
+
+	if calls.Load() >= 100 {
+		t.Errorf("forEach() made all %d calls after the failure", calls.Load())
+	}
+}
+
+func TestSortBranchesIsDeterministic(t *testing.T) {
+	startedAt := time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC)
+	branch2events := map[string][]Event{
+		"feature-c": {{CreatedAt: startedAt.Add(time.Hour)}},
+		"feature-b": {{CreatedAt: startedAt}},
+		"feature-a": {{CreatedAt: startedAt}},
+	}
+
+	for i := 0; i < 10; i++ {
+		got := sortBranches(branch2events)
+		want := []string{"feature-a", "feature-b", "feature-c"}
+
+		if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+			t.Fatalf("sortBranches() = %v, want %v", got, want)
+		}
+	}
+}
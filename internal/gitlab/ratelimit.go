@@ -0,0 +1,96 @@
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limits requests sent to every gitlab host, shared by all users of the host.
+// The host is paused when gitlab reports its rate limit has been exhausted
+type HostLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu          sync.Mutex
+	limiters    map[string]*rate.Limiter
+	pausedUntil map[string]time.Time
+}
+
+// Requests per second of every host, unlimited when zero
+func NewHostLimiter(requestsPerSecond float64, burst int) *HostLimiter {
+	limit := rate.Limit(requestsPerSecond)
+	if requestsPerSecond <= 0 {
+		limit = rate.Inf
+	}
+
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return &HostLimiter{
+		limit:       limit,
+		burst:       burst,
+		limiters:    make(map[string]*rate.Limiter),
+		pausedUntil: make(map[string]time.Time),
+	}
+}
+
+// Blocks until a request to the host is allowed or the context is done
+func (l *HostLimiter) Wait(ctx context.Context, host string) error {
+	limiter, pausedUntil := l.get(host)
+
+	if wait := time.Until(pausedUntil); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return limiter.Wait(ctx)
+}
+
+// Pauses the host until the rate limit is reset when gitlab reports none of requests are remaining.
+// See https://docs.gitlab.com/ee/administration/settings/user_and_ip_rate_limits.html#response-headers
+func (l *HostLimiter) Observe(host string, header http.Header, now time.Time) {
+	if header.Get("RateLimit-Remaining") != "0" {
+		return
+	}
+
+	reset, err := strconv.ParseInt(header.Get("RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	l.Pause(host, time.Unix(reset, 0))
+}
+
+func (l *HostLimiter) Pause(host string, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until.After(l.pausedUntil[host]) {
+		l.pausedUntil[host] = until
+	}
+}
+
+func (l *HostLimiter) get(host string) (*rate.Limiter, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limiter, ok := l.limiters[host]
+	if !ok {
+		limiter = rate.NewLimiter(l.limit, l.burst)
+		l.limiters[host] = limiter
+	}
+
+	return limiter, l.pausedUntil[host]
+}
@@ -0,0 +1,287 @@
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/report"
+	"golang.org/x/exp/slices"
+)
+
+// Version of recording files written by this build
+const RecordingFormatVersion = 1
+
+// Token sent by replayed requests, recordings never contain real ones
+const replayToken = "replayed"
+
+var ErrNotRecorded = errors.New("gitlab response has not been recorded")
+
+// Query parameters and JSON fields removed from recordings
+var (
+	sensitiveParams = []string{"private_token", "access_token"}
+	sensitiveFields = []string{"email", "public_email", "commit_email", "author_email", "committer_email"}
+)
+
+// Gitlab responses received while building a report, enough to build it again offline
+type Recording struct {
+	FormatVersion int       `json:"formatVersion"`
+	RecordedAt    time.Time `json:"recordedAt"`
+	BaseUrl       string    `json:"baseUrl"`
+	// User and accounts without tokens and email
+	User      report.User   `json:"user"`
+	Period    report.Period `json:"period"`
+	Exchanges []Exchange    `json:"exchanges"`
+}
+
+// Response gitlab sent to a request, the last one is kept for every url
+type Exchange struct {
+	Method string `json:"method"`
+	Url    string `json:"url"`
+	Status int    `json:"status"`
+	// Set for JSON responses, Text is set for the rest of them
+	Body json.RawMessage `json:"body,omitempty"`
+	Text string          `json:"text,omitempty"`
+}
+
+// Collects responses of requests made with the context it is attached to
+type Recorder struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+type recorderKey struct{}
+
+// Responses of requests made with the returned context are recorded
+func WithRecorder(ctx context.Context, recorder *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, recorder)
+}
+
+func recorderFromContext(ctx context.Context) *Recorder {
+	recorder, _ := ctx.Value(recorderKey{}).(*Recorder)
+	return recorder
+}
+
+// Records the response of the request made with the context, does nothing when no recorder is attached
+func record(ctx context.Context, method string, u url.URL, status int, body []byte) {
+	recorder := recorderFromContext(ctx)
+	if recorder == nil {
+		return
+	}
+
+	exchange := Exchange{Method: method, Url: sanitizeUrl(u), Status: status}
+	if sanitized, ok := sanitizeBody(body); ok {
+		exchange.Body = sanitized
+	} else {
+		exchange.Text = string(body)
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	for i := range recorder.exchanges {
+		if recorder.exchanges[i].Method == exchange.Method && recorder.exchanges[i].Url == exchange.Url {
+			recorder.exchanges[i] = exchange
+			return
+		}
+	}
+	recorder.exchanges = append(recorder.exchanges, exchange)
+}
+
+// Returns everything recorded so far along with the user the report has been built for
+func (r *Recorder) Recording(baseUrl string, user report.User, period report.Period) Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return Recording{
+		FormatVersion: RecordingFormatVersion,
+		RecordedAt:    time.Now().UTC(),
+		BaseUrl:       baseUrl,
+		User:          sanitizeUser(user),
+		Period:        period,
+		Exchanges:     append([]Exchange(nil), r.exchanges...),
+	}
+}
+
+// Writes the recording as indented JSON, so it can be reviewed before being shared
+func WriteRecording(path string, recording Recording) error {
+	data, err := json.MarshalIndent(recording, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode recording: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("could not create recordings directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("could not write recording: %w", err)
+	}
+
+	return nil
+}
+
+func LoadRecording(path string) (Recording, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Recording{}, fmt.Errorf("could not read recording: %w", err)
+	}
+
+	return parseRecording(data)
+}
+
+func parseRecording(data []byte) (Recording, error) {
+	var recording Recording
+	if err := json.Unmarshal(data, &recording); err != nil {
+		return Recording{}, fmt.Errorf("could not parse recording: %w", err)
+	}
+
+	if recording.FormatVersion != RecordingFormatVersion {
+		return Recording{}, fmt.Errorf("unsupported recording format version %d", recording.FormatVersion)
+	}
+
+	return recording, nil
+}
+
+// User the recorded report has been built for, with placeholder tokens
+// so every recorded account is used
+func (r Recording) ReplayUser() report.User {
+	user := r.User
+	if user.GitlabId != 0 {
+		user.UserToken = replayToken
+	}
+
+	user.Accounts = append([]report.Account(nil), r.User.Accounts...)
+	for i := range user.Accounts {
+		user.Accounts[i].Token = replayToken
+	}
+
+	return user
+}
+
+// Client answering requests with the recorded responses only, without retries and cache
+func NewReplayClient(recording Recording) (*GitlabClient, error) {
+	return NewClient(ClientConfig{
+		BaseUrl:   recording.BaseUrl,
+		Transport: &replayTransport{exchanges: recording.Exchanges},
+		Retry:     RetryPolicy{MaxAttempts: 1},
+	})
+}
+
+type replayTransport struct {
+	exchanges []Exchange
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	key := sanitizeUrl(*req.URL)
+	for _, exchange := range t.exchanges {
+		if exchange.Method != req.Method || exchange.Url != key {
+			continue
+		}
+
+		body := []byte(exchange.Body)
+		if exchange.Body == nil {
+			body = []byte(exchange.Text)
+		}
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", exchange.Status, http.StatusText(exchange.Status)),
+			StatusCode:    exchange.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": []string{"application/json"}},
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, req.Method, key)
+}
+
+func sanitizeUrl(u url.URL) string {
+	u.User = nil
+	query := u.Query()
+	for _, param := range sensitiveParams {
+		query.Del(param)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// Replaces personal fields of JSON responses, reports false for other bodies
+func sanitizeBody(body []byte) (json.RawMessage, bool) {
+	if len(body) == 0 || !json.Valid(body) {
+		return nil, false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// Ids are kept exactly as they are
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, false
+	}
+
+	sanitized, err := json.Marshal(redact(value))
+	if err != nil {
+		return nil, false
+	}
+
+	return sanitized, true
+}
+
+func redact(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if slices.Contains(sensitiveFields, key) {
+				v[key] = "redacted"
+				continue
+			}
+			v[key] = redact(field)
+		}
+	case []any:
+		for i := range v {
+			v[i] = redact(v[i])
+		}
+	}
+
+	return value
+}
+
+func sanitizeUser(user report.User) report.User {
+	sanitized := report.User{
+		Id:             user.Id,
+		GitlabId:       user.GitlabId,
+		GitlabHost:     user.GitlabHost,
+		TimezoneOffset: user.TimezoneOffset,
+	}
+
+	for _, account := range user.Accounts {
+		account.Token = ""
+		sanitized.Accounts = append(sanitized.Accounts, account)
+	}
+
+	return sanitized
+}
@@ -0,0 +1,232 @@
+package gitlab_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/gitlab"
+	"github.com/BalanceBalls/report-generator/internal/gitlab/gitlabtest"
+	"github.com/BalanceBalls/report-generator/internal/report"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	srv := gitlabtest.NewServer(t, gitlabtest.LoadScenario(t, filepath.Join("testdata", "scenarios", "overlapping_branches.json")))
+	builder := newBuilder(t, srv)
+
+	user := report.User{Id: 1, GitlabId: 7, UserToken: "glpat-secret", UserEmail: "jane@example.com"}
+	period := report.UserDay(user, time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC))
+
+	recorder := gitlab.NewRecorder()
+	recorded, err := builder.Build(gitlab.WithRecorder(context.Background(), recorder), user, period)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "recording.json")
+	if err := gitlab.WriteRecording(path, recorder.Recording(srv.BaseUrl(), user, period)); err != nil {
+		t.Fatalf("WriteRecording() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read recording: %v", err)
+	}
+
+	if strings.Contains(string(data), "glpat-secret") || strings.Contains(string(data), "jane@example.com") {
+		t.Error("recording contains the token or email of the user")
+	}
+
+	// Nothing is requested from gitlab while replaying
+	srv.Close()
+
+	replayed := replay(t, path)
+	source := strings.TrimPrefix(srv.URL, "http://")
+	assertRows(t, replayed.Rows, recorded.Rows, source)
+}
+
+func TestRecomputeArchived(t *testing.T) {
+	srv := gitlabtest.NewServer(t, gitlabtest.LoadScenario(t, filepath.Join("testdata", "scenarios", "single_branch.json")))
+	builder := newBuilder(t, srv)
+
+	user := report.User{Id: 1, GitlabId: 7, UserToken: "glpat-secret", TimezoneOffset: 300}
+	period := report.UserDay(user, time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC))
+
+	recorder := gitlab.NewRecorder()
+	built, err := builder.Build(gitlab.WithRecorder(context.Background(), recorder), user, period)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	data, err := gitlab.EncodeRecording(recorder.Recording(srv.BaseUrl(), user, period))
+	if err != nil {
+		t.Fatalf("EncodeRecording() error = %v", err)
+	}
+	srv.Close()
+
+	recording, err := gitlab.DecodeRecording(data)
+	if err != nil {
+		t.Fatalf("DecodeRecording() error = %v", err)
+	}
+
+	if !recording.Period.Start.Equal(period.Start) || !recording.Period.End.Equal(period.End) {
+		t.Errorf("decoded period = %v - %v, want %v - %v",
+			recording.Period.Start, recording.Period.End, period.Start, period.End)
+	}
+
+	recomputed, err := gitlab.Recompute(context.Background(), recording, 2)
+	if err != nil {
+		t.Fatalf("Recompute() error = %v", err)
+	}
+
+	assertRows(t, recomputed.Rows, built.Rows, strings.TrimPrefix(srv.URL, "http://"))
+}
+
+func TestRecomputeArchivedMultiCommitPushes(t *testing.T) {
+	recording, built, source := recordScenario(t, "multi_commit_push.json")
+
+	recomputed, err := gitlab.Recompute(context.Background(), recording, 2)
+	if err != nil {
+		t.Fatalf("Recompute() error = %v", err)
+	}
+
+	assertRows(t, recomputed.Rows, built.Rows, source)
+}
+
+// Archives made before pushes were expanded into commits have no compare responses
+func TestRecomputeArchiveWithoutPushedCommits(t *testing.T) {
+	recording, _, _ := recordScenario(t, "multi_commit_push.json")
+
+	var exchanges []gitlab.Exchange
+	for _, exchange := range recording.Exchanges {
+		if !strings.Contains(exchange.Url, "/repository/") {
+			exchanges = append(exchanges, exchange)
+		}
+	}
+	recording.Exchanges = exchanges
+
+	_, err := gitlab.Recompute(context.Background(), recording, 2)
+	if !errors.Is(err, gitlab.ErrNotRecorded) {
+		t.Errorf("Recompute() error = %v, want %v", err, gitlab.ErrNotRecorded)
+	}
+}
+
+// Archives made before branch MRs were looked up have no responses for the lookup
+func TestRecomputeArchiveWithoutBranchMergeRequests(t *testing.T) {
+	recording, _, _ := recordScenario(t, "mr_between_days.json")
+
+	var exchanges []gitlab.Exchange
+	for _, exchange := range recording.Exchanges {
+		if !strings.Contains(exchange.Url, "source_branch=") {
+			exchanges = append(exchanges, exchange)
+		}
+	}
+	recording.Exchanges = exchanges
+
+	_, err := gitlab.Recompute(context.Background(), recording, 2)
+	if !errors.Is(err, gitlab.ErrNotRecorded) {
+		t.Errorf("Recompute() error = %v, want %v", err, gitlab.ErrNotRecorded)
+	}
+}
+
+// Builds the report of the scenario recording gitlab responses,
+// returns the recording, the built report and its source
+func recordScenario(t *testing.T, scenario string) (gitlab.Recording, report.Report, string) {
+	t.Helper()
+
+	srv := gitlabtest.NewServer(t, gitlabtest.LoadScenario(t, filepath.Join("testdata", "scenarios", scenario)))
+	builder := newBuilder(t, srv)
+
+	user := report.User{Id: 1, GitlabId: 7, UserToken: "glpat-secret"}
+	period := report.UserDay(user, time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC))
+
+	recorder := gitlab.NewRecorder()
+	built, err := builder.Build(gitlab.WithRecorder(context.Background(), recorder), user, period)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	srv.Close()
+
+	return recorder.Recording(srv.BaseUrl(), user, period), built, strings.TrimPrefix(srv.URL, "http://")
+}
+
+func TestDecodeRecordingRejectsGarbage(t *testing.T) {
+	if _, err := gitlab.DecodeRecording([]byte("not gzip")); err == nil {
+		t.Error("DecodeRecording() error = nil, want error for data that is not an archive")
+	}
+}
+
+func TestReplayMissingResponse(t *testing.T) {
+	recording := gitlab.Recording{
+		FormatVersion: gitlab.RecordingFormatVersion,
+		BaseUrl:       "https://gitlab.example.com/api/v4",
+		User:          report.User{GitlabId: 7},
+	}
+
+	client, err := gitlab.NewReplayClient(recording)
+	if err != nil {
+		t.Fatalf("NewReplayClient() error = %v", err)
+	}
+
+	_, err = gitlab.NewReportBuilder(*client, 1).Build(context.Background(), recording.ReplayUser(), recording.Period)
+	if !errors.Is(err, gitlab.ErrNotRecorded) {
+		t.Errorf("Build() error = %v, want %v", err, gitlab.ErrNotRecorded)
+	}
+}
+
+// Recorded reports whose hours have been reported as wrong, pinned to the current behaviour
+func TestReplayRegressions(t *testing.T) {
+	tests := []struct {
+		recording string
+		wantRows  []report.ReportRow
+	}{
+		{
+			// Hours spent on TASK-15 are counted for TASK-12 the user returned to later
+			recording: "revisited_branch.json",
+			wantRows: []report.ReportRow{
+				{
+					Date: time.Date(2023, 10, 5, 6, 0, 0, 0, time.UTC),
+					Task: "TASK-12",
+					Link: "https://gitlab.example.com/team/app/-/commit/0a1b2c3d \n " +
+						"https://gitlab.example.com/team/app/-/commit/1b2c3d4e \n " +
+						"https://gitlab.example.com/team/app/-/commit/3d4e5f60",
+					TimeSpent: 6,
+				},
+				{
+					Date:      time.Date(2023, 10, 5, 8, 0, 0, 0, time.UTC),
+					Task:      "TASK-15",
+					Link:      "https://gitlab.example.com/team/app/-/commit/2c3d4e5f",
+					TimeSpent: 0,
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.recording, func(t *testing.T) {
+			result := replay(t, filepath.Join("testdata", "recordings", tc.recording))
+			assertRows(t, result.Rows, tc.wantRows, "gitlab.example.com")
+		})
+	}
+}
+
+func replay(t *testing.T, path string) report.Report {
+	t.Helper()
+
+	recording, err := gitlab.LoadRecording(path)
+	if err != nil {
+		t.Fatalf("LoadRecording() error = %v", err)
+	}
+
+	result, err := gitlab.Recompute(context.Background(), recording, 4)
+	if err != nil {
+		t.Fatalf("Recompute() error = %v", err)
+	}
+
+	return result
+}
@@ -0,0 +1,70 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Retries of failed idempotent requests with exponential backoff and full jitter
+type RetryPolicy struct {
+	// Attempts including the first one, requests are not retried when less than two
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Returns the delay before the next attempt and whether it should be made at all.
+// Delay requested by gitlab is honoured unless it exceeds the maximum delay
+func (p RetryPolicy) next(ctx context.Context, attempt int, err error) (time.Duration, bool) {
+	if attempt+1 >= p.MaxAttempts || ctx.Err() != nil {
+		return 0, false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		if !statusErr.Temporary() {
+			return 0, false
+		}
+
+		if statusErr.RetryAfter > 0 {
+			return statusErr.RetryAfter, statusErr.RetryAfter <= p.MaxDelay
+		}
+	}
+
+	return p.backoff(attempt), true
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.MaxDelay
+	if attempt < 30 && p.BaseDelay<<attempt < p.MaxDelay {
+		delay = p.BaseDelay << attempt
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// Retry-After is either a number of seconds or a date
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
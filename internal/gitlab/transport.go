@@ -0,0 +1,137 @@
+package gitlab
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Connection settings of gitlab API client
+type ClientConfig struct {
+	// Full API url, e.g. https://gitlab.example.com/api/v4
+	BaseUrl string
+
+	// PEM bundle of CAs trusted in addition to the system ones
+	CaFile string
+	// Client certificate and key presented to gitlab, both in PEM
+	ClientCertFile string
+	ClientKeyFile  string
+	// Proxy requests are sent through, HTTP(S)_PROXY variables are used when empty
+	ProxyUrl string
+
+	// Timeout of a single request attempt including reading the response
+	RequestTimeout      time.Duration
+	DialTimeout         time.Duration
+	IdleConnTimeout     time.Duration
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// Unlimited when zero
+	MaxConnsPerHost int
+
+	Retry RetryPolicy
+	// Requests per second to every host, unlimited when zero
+	RateLimit float64
+	RateBurst int
+
+	// Merge requests and commits are fetched every time when nil
+	Cache *Cache
+
+	// Replaces the transport built of the settings above, used to replay recorded responses
+	Transport http.RoundTripper
+}
+
+func parseBaseUrl(rawUrl string) (*url.URL, error) {
+	baseUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse gitlab base url: %w", err)
+	}
+
+	if baseUrl.Scheme != "http" && baseUrl.Scheme != "https" {
+		return nil, fmt.Errorf("gitlab base url scheme must be http or https, got %q", baseUrl.Scheme)
+	}
+
+	if baseUrl.Host == "" {
+		return nil, errors.New("gitlab base url has no host")
+	}
+
+	return baseUrl, nil
+}
+
+func newHttpClient(cfg ClientConfig) (*http.Client, error) {
+	if cfg.Transport != nil {
+		return &http.Client{Transport: cfg.Transport, Timeout: cfg.RequestTimeout}, nil
+	}
+
+	tlsConfig, err := newTlsConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyUrl != "" {
+		proxyUrl, err := url.Parse(cfg.ProxyUrl)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse proxy url: %w", err)
+		}
+		proxy = http.ProxyURL(proxyUrl)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy:               proxy,
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+		ForceAttemptHTTP2:   true,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.MaxConnsPerHost,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   cfg.RequestTimeout,
+	}, nil
+}
+
+func newTlsConfig(cfg ClientConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CaFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		bundle, err := os.ReadFile(cfg.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA bundle: %w", err)
+		}
+
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %q", cfg.CaFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -3,12 +3,15 @@ package gitlab
 import (
 	"errors"
 	"time"
+
+	"golang.org/x/exp/slices"
 )
 
 var (
-	ErrNoGitActions = errors.New("no gitlab actions to report found for current day")
+	ErrNoGitActions = errors.New("no gitlab actions to report found for the period")
 	ErrNoUserInCtx  = errors.New("could not get user from context")
 	ErrNoTokenInCtx = errors.New("could not get token from context")
+	ErrNoAccounts   = errors.New("user has no accounts to collect git actions from")
 )
 
 type Event struct {
@@ -22,6 +25,7 @@ type Event struct {
 	PushData struct {
 		Action      string `json:"action"`
 		RefType     string `json:"ref_type"`
+		CommitCount int    `json:"commit_count"` // commits pushed
 		CommitFrom  string `json:"commit_from"`  // previous commit hash
 		CommitTo    string `json:"commit_to"`    // current commit hash
 		Ref         string `json:"ref"`          // branch name
@@ -29,6 +33,8 @@ type Event struct {
 	} `json:"push_data"`
 
 	MR *MergeRequest `json:"-"`
+	// Set for every commit of a push expanded into them
+	Commit *Commit `json:"-"`
 }
 
 type MergeRequest struct {
@@ -41,9 +47,58 @@ type MergeRequest struct {
 	IssueUrl     string `json:"target_title"`
 }
 
+type User struct {
+	Id       int    `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	State    string `json:"state"`
+}
+
+// Personal access token the request has been made with
+type PersonalAccessToken struct {
+	Id        int      `json:"id"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	Active    bool     `json:"active"`
+	Revoked   bool     `json:"revoked"`
+	ExpiresAt string   `json:"expires_at"` // date formatted as YYYY-MM-DD, empty if token never expires
+}
+
+// Returns the moment the token stops working.
+// False is returned for tokens without expiration date
+func (t PersonalAccessToken) Expiry() (time.Time, bool) {
+	if t.ExpiresAt == "" {
+		return time.Time{}, false
+	}
+
+	expiresAt, err := time.Parse(time.DateOnly, t.ExpiresAt)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return expiresAt, true
+}
+
+// Checks whether the token grants at least one of the scopes
+func (t PersonalAccessToken) HasAnyScope(scopes ...string) bool {
+	for _, scope := range scopes {
+		if slices.Contains(t.Scopes, scope) {
+			return true
+		}
+	}
+
+	return false
+}
+
 type Commit struct {
-	Id      string `json:"id"`
-	ShortId string `json:"short_id"`
-	WebUrl  string `json:"web_url"`
-	Title   string `json:"title"`
+	Id           string    `json:"id"`
+	ShortId      string    `json:"short_id"`
+	WebUrl       string    `json:"web_url"`
+	Title        string    `json:"title"`
+	AuthoredDate time.Time `json:"authored_date"`
+}
+
+type Compare struct {
+	Commits []Commit `json:"commits"`
 }
@@ -0,0 +1,327 @@
+package logger
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rotated files are named after the active one with the rotation time appended,
+// e.g. bot.log -> bot-20231005T174836.000.log.gz
+const (
+	rotatedTimeLayout = "20060102T150405.000"
+	compressedSuffix  = ".gz"
+)
+
+// Log file writer starting a new file when the current one grows too big or too old.
+// Rotated files are compressed and only the given number of the latest ones is kept
+type RotatingWriter struct {
+	path      string
+	maxSize   int64
+	interval  time.Duration
+	retention int
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+
+	// Compression of rotated files runs in background, one pass at a time
+	compressing sync.WaitGroup
+	compressMu  sync.Mutex
+}
+
+// Rotation by size is disabled when maxSize is zero, rotation by time when interval is zero.
+// Every rotated file is kept when retention is zero
+func NewRotatingWriter(path string, maxSize int64, interval time.Duration, retention int) (*RotatingWriter, error) {
+	w := &RotatingWriter{
+		path:      path,
+		maxSize:   maxSize,
+		interval:  interval,
+		retention: retention,
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("could not create log directory: %w", err)
+		}
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	// Rotated files may have been left uncompressed before restart
+	w.compressRotated()
+
+	return w, nil
+}
+
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	if w.file != nil && w.shouldRotate(len(p)) {
+		if err := w.rotate(); err != nil {
+			// Keep writing to the active file, rotation is retried on the next write
+			fmt.Fprintf(os.Stderr, "could not rotate log file: %v\n", err)
+		}
+	}
+
+	// The active file is closed when the rotation has failed
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+
+	return n, err
+}
+
+// Closes the active file and waits for rotated files to be compressed
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.compressing.Wait()
+
+	return err
+}
+
+func (w *RotatingWriter) shouldRotate(writeLen int) bool {
+	// Nothing to rotate yet
+	if w.size == 0 {
+		return false
+	}
+
+	if w.maxSize > 0 && w.size+int64(writeLen) > w.maxSize {
+		return true
+	}
+
+	return w.interval > 0 && time.Since(w.openedAt) >= w.interval
+}
+
+// Appends to the existing file, so logs written before restart are kept.
+// The existing file has been started by the latest rotation, so its age survives restarts
+func (w *RotatingWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("could not read log file info: %w", err)
+	}
+
+	w.file = file
+	w.size = info.Size()
+	w.openedAt = time.Now()
+	if w.size > 0 {
+		w.openedAt = w.lastRotation()
+	}
+
+	return nil
+}
+
+// Returns the time of the latest rotation found by names of rotated files,
+// zero time when nothing has been rotated yet, so a file of unknown age is rotated by time
+func (w *RotatingWriter) lastRotation() time.Time {
+	ext := filepath.Ext(w.path)
+	base := strings.TrimSuffix(w.path, ext)
+
+	// Rotated files may still be uncompressed after a crash
+	files, _ := filepath.Glob(base + "-*" + ext + "*")
+
+	var latest time.Time
+	for _, file := range files {
+		rotatedAt, ok := w.rotatedAt(file)
+		if ok && rotatedAt.After(latest) {
+			latest = rotatedAt
+		}
+	}
+
+	return latest
+}
+
+// Parses the rotation time from the name of a rotated file, compressed or not
+func (w *RotatingWriter) rotatedAt(file string) (time.Time, bool) {
+	ext := filepath.Ext(w.path)
+	base := strings.TrimSuffix(w.path, ext)
+
+	stamp := strings.TrimPrefix(file, base+"-")
+	stamp = strings.TrimSuffix(strings.TrimSuffix(stamp, compressedSuffix), ext)
+
+	rotatedAt, err := time.ParseInLocation(rotatedTimeLayout, stamp, time.Local)
+	return rotatedAt, err == nil
+}
+
+// On failure the active file is left closed and gets reopened on the next write
+func (w *RotatingWriter) rotate() error {
+	err := w.file.Close()
+	w.file = nil
+	if err != nil {
+		return fmt.Errorf("could not close log file: %w", err)
+	}
+
+	if err := os.Rename(w.path, w.rotatedName(time.Now())); err != nil {
+		return fmt.Errorf("could not rename log file: %w", err)
+	}
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	w.compressRotated()
+	return nil
+}
+
+// Compresses every uncompressed rotated file in background, including the ones
+// a failed compression or a crash has left behind, then removes outdated files
+func (w *RotatingWriter) compressRotated() {
+	w.compressing.Add(1)
+	go func() {
+		defer w.compressing.Done()
+
+		w.compressMu.Lock()
+		defer w.compressMu.Unlock()
+
+		files, err := w.uncompressed()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not list rotated logs: %v\n", err)
+		}
+
+		for _, file := range files {
+			if err := compress(file); err != nil {
+				fmt.Fprintf(os.Stderr, "could not compress rotated log %s: %v\n", file, err)
+			}
+		}
+
+		if err := w.prune(); err != nil {
+			fmt.Fprintf(os.Stderr, "could not remove outdated logs: %v\n", err)
+		}
+	}()
+}
+
+// Lists rotated files which have not been compressed yet
+func (w *RotatingWriter) uncompressed() ([]string, error) {
+	ext := filepath.Ext(w.path)
+
+	files, err := filepath.Glob(strings.TrimSuffix(w.path, ext) + "-*" + ext)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated := make([]string, 0, len(files))
+	for _, file := range files {
+		// Compressed files match too when the log file has no extension
+		if _, ok := w.rotatedAt(file); ok && !strings.HasSuffix(file, compressedSuffix) {
+			rotated = append(rotated, file)
+		}
+	}
+
+	return rotated, nil
+}
+
+func (w *RotatingWriter) rotatedName(at time.Time) string {
+	ext := filepath.Ext(w.path)
+	base := strings.TrimSuffix(w.path, ext)
+
+	return fmt.Sprintf("%s-%s%s", base, at.Format(rotatedTimeLayout), ext)
+}
+
+// Lists compressed rotated files from the oldest to the latest
+func (w *RotatingWriter) Rotated() ([]string, error) {
+	ext := filepath.Ext(w.path)
+	pattern := strings.TrimSuffix(w.path, ext) + "-*" + ext + compressedSuffix
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// Time layout sorts in chronological order
+	sort.Strings(files)
+	return files, nil
+}
+
+func (w *RotatingWriter) prune() error {
+	if w.retention <= 0 {
+		return nil
+	}
+
+	files, err := w.Rotated()
+	if err != nil {
+		return err
+	}
+
+	if len(files) <= w.retention {
+		return nil
+	}
+
+	for _, outdated := range files[:len(files)-w.retention] {
+		// Could have been removed by a concurrent prune
+		if err := os.Remove(outdated); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Replaces the file with its gzip compressed copy
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+compressedSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
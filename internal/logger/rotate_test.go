@@ -0,0 +1,270 @@
+package logger
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.log")
+	w, err := NewRotatingWriter(path, 10, 0, 0)
+	if err != nil {
+		t.Fatalf("NewRotatingWriter() error = %v", err)
+	}
+
+	for _, line := range []string{"first\n", "second\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	rotated, err := w.Rotated()
+	if err != nil {
+		t.Fatalf("Rotated() error = %v", err)
+	}
+
+	if len(rotated) != 1 {
+		t.Fatalf("Rotated() = %v, want a single file", rotated)
+	}
+
+	if got := readGzip(t, rotated[0]); got != "first\n" {
+		t.Errorf("rotated file content = %q, want %q", got, "first\n")
+	}
+
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read log file: %v", err)
+	}
+
+	if string(current) != "second\n" {
+		t.Errorf("log file content = %q, want %q", current, "second\n")
+	}
+}
+
+func TestRotatesByTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.log")
+	w, err := NewRotatingWriter(path, 0, time.Hour, 0)
+	if err != nil {
+		t.Fatalf("NewRotatingWriter() error = %v", err)
+	}
+	defer w.Close()
+
+	if _, err := w.Write([]byte("first\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	w.openedAt = w.openedAt.Add(-time.Hour)
+	if _, err := w.Write([]byte("second\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if w.size != int64(len("second\n")) {
+		t.Errorf("log file size = %d, want the file to be rotated", w.size)
+	}
+}
+
+func TestRotatesByTimeAcrossRestarts(t *testing.T) {
+	tests := []struct {
+		name        string
+		rotatedAgo  time.Duration
+		wantRotated bool
+	}{
+		{name: "rotated before the interval", rotatedAgo: 2 * time.Hour, wantRotated: true},
+		{name: "rotated within the interval", rotatedAgo: 10 * time.Minute, wantRotated: false},
+		{name: "never rotated", wantRotated: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "bot.log")
+			if err := os.WriteFile(path, []byte("before restart\n"), 0o644); err != nil {
+				t.Fatalf("could not create log file: %v", err)
+			}
+
+			if tc.rotatedAgo > 0 {
+				rotated := filepath.Join(dir, "bot-"+time.Now().Add(-tc.rotatedAgo).Format(rotatedTimeLayout)+".log.gz")
+				if err := os.WriteFile(rotated, nil, 0o644); err != nil {
+					t.Fatalf("could not create rotated file: %v", err)
+				}
+			}
+
+			w, err := NewRotatingWriter(path, 0, time.Hour, 0)
+			if err != nil {
+				t.Fatalf("NewRotatingWriter() error = %v", err)
+			}
+			defer w.Close()
+
+			if _, err := w.Write([]byte("after restart\n")); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			rotated := w.size == int64(len("after restart\n"))
+			if rotated != tc.wantRotated {
+				t.Errorf("log file rotated = %v, want %v", rotated, tc.wantRotated)
+			}
+		})
+	}
+}
+
+func TestKeepsExistingLogs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.log")
+	if err := os.WriteFile(path, []byte("before restart\n"), 0o644); err != nil {
+		t.Fatalf("could not create log file: %v", err)
+	}
+
+	w, err := NewRotatingWriter(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("NewRotatingWriter() error = %v", err)
+	}
+
+	if _, err := w.Write([]byte("after restart\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	w.Close()
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read log file: %v", err)
+	}
+
+	if string(got) != "before restart\nafter restart\n" {
+		t.Errorf("log file content = %q, want both lines", got)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bot.log")
+	for _, name := range []string{"bot-20231001T000000.000.log.gz", "bot-20231002T000000.000.log.gz"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatalf("could not create rotated file: %v", err)
+		}
+	}
+
+	w, err := NewRotatingWriter(path, 1, 0, 2)
+	if err != nil {
+		t.Fatalf("NewRotatingWriter() error = %v", err)
+	}
+
+	w.Write([]byte("first\n"))
+	w.Write([]byte("second\n"))
+	w.Close()
+
+	rotated, err := w.Rotated()
+	if err != nil {
+		t.Fatalf("Rotated() error = %v", err)
+	}
+
+	if len(rotated) != 2 || !strings.HasSuffix(rotated[0], "bot-20231002T000000.000.log.gz") {
+		t.Errorf("Rotated() = %v, want the oldest file to be removed", rotated)
+	}
+}
+
+func TestRecoversFromFailedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.log")
+	w, err := NewRotatingWriter(path, 10, 0, 0)
+	if err != nil {
+		t.Fatalf("NewRotatingWriter() error = %v", err)
+	}
+	defer w.Close()
+
+	if _, err := w.Write([]byte("first\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// Renaming a missing file fails the rotation
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("could not remove log file: %v", err)
+	}
+
+	for _, line := range []string{"second\n", "third\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read log file: %v", err)
+	}
+
+	if string(current) != "third\n" {
+		t.Errorf("log file content = %q, want %q", current, "third\n")
+	}
+}
+
+func TestCompressesLeftoverRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bot.log")
+	files := map[string]string{
+		"bot-20231001T000000.000.log.gz": "",
+		"bot-20231002T000000.000.log.gz": "",
+		"bot-20231003T000000.000.log":    "left by crash\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("could not create rotated file: %v", err)
+		}
+	}
+
+	w, err := NewRotatingWriter(path, 0, 0, 2)
+	if err != nil {
+		t.Fatalf("NewRotatingWriter() error = %v", err)
+	}
+	w.Close()
+
+	rotated, err := w.Rotated()
+	if err != nil {
+		t.Fatalf("Rotated() error = %v", err)
+	}
+
+	want := []string{
+		filepath.Join(dir, "bot-20231002T000000.000.log.gz"),
+		filepath.Join(dir, "bot-20231003T000000.000.log.gz"),
+	}
+	if strings.Join(rotated, ",") != strings.Join(want, ",") {
+		t.Fatalf("Rotated() = %v, want %v", rotated, want)
+	}
+
+	if got := readGzip(t, rotated[1]); got != "left by crash\n" {
+		t.Errorf("rotated file content = %q, want %q", got, "left by crash\n")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "bot-20231003T000000.000.log")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("uncompressed rotated file is kept, stat error = %v", err)
+	}
+}
+
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("could not open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("could not decompress %s: %v", path, err)
+	}
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("could not read %s: %v", path, err)
+	}
+
+	return string(data)
+}
@@ -0,0 +1,286 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics collected by the bot, exposed in Prometheus text format
+var (
+	Default = NewRegistry()
+
+	Commands = Default.NewCounterVec("bot_commands_total",
+		"Commands received from users", "command")
+	ReportGenerations = Default.NewCounterVec("bot_report_generations_total",
+		"Report generations by result", "result")
+	GitlabRequestDuration = Default.NewHistogramVec("bot_gitlab_request_duration_seconds",
+		"Duration of gitlab API requests", DefaultBuckets, "host", "status")
+	StorageErrors = Default.NewCounterVec("bot_storage_errors_total",
+		"Failed storage operations", "operation")
+	GitlabCacheRequests = Default.NewCounterVec("bot_gitlab_cache_requests_total",
+		"Lookups of cached gitlab responses by result", "kind", "result")
+)
+
+// Request duration buckets in seconds
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(w io.Writer) error
+}
+
+// Set of metrics written together
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	counter := &CounterVec{
+		desc:   desc{name: name, help: help, labels: labels},
+		values: make(map[string]*counterValue),
+	}
+	r.register(counter)
+
+	return counter
+}
+
+func (r *Registry) NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	histogram := &HistogramVec{
+		desc:    desc{name: name, help: help, labels: labels},
+		buckets: append([]float64(nil), buckets...),
+		values:  make(map[string]*histogramValue),
+	}
+	sort.Float64s(histogram.buckets)
+	r.register(histogram)
+
+	return histogram
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics = append(r.metrics, m)
+}
+
+// Writes every metric in Prometheus text exposition format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	for _, m := range metrics {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d desc) writeHeader(w io.Writer, kind string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, kind)
+	return err
+}
+
+// Label values are joined into a single map key
+func (d desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", d.name, len(d.labels), len(labelValues)))
+	}
+
+	return strings.Join(labelValues, "\xff")
+}
+
+// Formats labels as {name="value",...}, extra pairs are appended as is
+func (d desc) formatLabels(labelValues []string, extra ...string) string {
+	pairs := make([]string, 0, len(labelValues)+len(extra)/2)
+	for i, value := range labelValues {
+		pairs = append(pairs, d.labels[i]+"="+strconv.Quote(value))
+	}
+
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+strconv.Quote(extra[i+1]))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+type counterValue struct {
+	labelValues []string
+	value       float64
+}
+
+// Monotonically increasing values partitioned by labels
+type CounterVec struct {
+	desc
+
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	key := c.key(labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.values[key]
+	if !ok {
+		value = &counterValue{labelValues: append([]string(nil), labelValues...)}
+		c.values[key] = value
+	}
+	value.value += delta
+}
+
+// Returns the current value, used by tests
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if value, ok := c.values[key]; ok {
+		return value.value
+	}
+
+	return 0
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	if err := c.writeHeader(w, "counter"); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range sortedKeys(c.values) {
+		value := c.values[key]
+		_, err := fmt.Fprintf(w, "%s%s %s\n", c.name, c.formatLabels(value.labelValues), formatFloat(value.value))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type histogramValue struct {
+	labelValues []string
+	// Count of observations per bucket, not cumulative
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Distribution of observed values partitioned by labels
+type HistogramVec struct {
+	desc
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	value, ok := h.values[key]
+	if !ok {
+		value = &histogramValue{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = value
+	}
+
+	// Values above the largest bucket are only counted by +Inf
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		value.counts[i]++
+	}
+	value.count++
+	value.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	if err := h.writeHeader(w, "histogram"); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, key := range sortedKeys(h.values) {
+		value := h.values[key]
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += value.counts[i]
+			labels := h.formatLabels(value.labelValues, "le", formatFloat(bound))
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels, cumulative); err != nil {
+				return err
+			}
+		}
+
+		labels := h.formatLabels(value.labelValues, "le", "+Inf")
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels, value.count); err != nil {
+			return err
+		}
+
+		labels = h.formatLabels(value.labelValues)
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatFloat(value.sum)); err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, value.count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	registry := NewRegistry()
+	commands := registry.NewCounterVec("commands_total", "Commands", "command")
+	durations := registry.NewHistogramVec("duration_seconds", "Durations", []float64{1, 0.5}, "status")
+
+	commands.Inc("help")
+	commands.Inc("help")
+	commands.Inc("gen_day")
+	durations.Observe(0.2, "200")
+	durations.Observe(0.7, "200")
+	durations.Observe(3, "200")
+
+	var out strings.Builder
+	if err := registry.Write(&out); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	want := `# HELP commands_total Commands
+# TYPE commands_total counter
+commands_total{command="gen_day"} 1
+commands_total{command="help"} 2
+# HELP duration_seconds Durations
+# TYPE duration_seconds histogram
+duration_seconds_bucket{status="200",le="0.5"} 1
+duration_seconds_bucket{status="200",le="1"} 2
+duration_seconds_bucket{status="200",le="+Inf"} 3
+duration_seconds_sum{status="200"} 3.9
+duration_seconds_count{status="200"} 3
+`
+
+	if out.String() != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	if got := commands.Value("help"); got != 2 {
+		t.Errorf("Value() = %v, want 2", got)
+	}
+}
@@ -1,9 +1,19 @@
 package report
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
 
 type LoggerKey interface{}
 
+// Supported source account providers
+const (
+	ProviderGitlab = "gitlab"
+)
+
 type User struct {
 	Id        int64  `json:"id"`
 	GitlabId  int    `json:"gitlabId"`
@@ -11,15 +21,43 @@ type User struct {
 	UserToken string `json:"userToken"`
 	IsActive  bool   `json:"isActive"`
 
+	// Gitlab host of the primary account,
+	// the default one is used when empty
+	GitlabHost string `json:"gitlabHost"`
+
 	// Minutes from UTC
-	TimezoneOffset int      `json:"timezoneOffset"`
-	Reports        []Report `json:"reports"`
+	TimezoneOffset int       `json:"timezoneOffset"`
+	Reports        []Report  `json:"reports"`
+	Accounts       []Account `json:"accounts"`
+}
+
+// Account linked to a user in addition to the one
+// configured with user's gitlab id and token
+type Account struct {
+	Id         int64  `json:"accountId"`
+	UserId     int64  `json:"accountUserId"`
+	Provider   string `json:"provider"`
+	Host       string `json:"host"`
+	ExternalId int    `json:"externalId"`
+	Token      string `json:"token"`
 }
 
 type Report struct {
-	Id     int64       `json:"reportId"`
-	UserId int64       `json:"reportUserId"`
-	Rows   []ReportRow `json:"rows"`
+	Id          int64     `json:"reportId"`
+	UserId      int64     `json:"reportUserId"`
+	PeriodStart time.Time `json:"periodStart"`
+	PeriodEnd   time.Time `json:"periodEnd"`
+	// Hosts git actions have been collected from
+	Source string `json:"source"`
+	// Format of the file the report has been generated as
+	Format string `json:"format"`
+	// Reports regenerated for the same period are stored as
+	// new versions when git data has changed since the last one
+	Version     int         `json:"version"`
+	ContentHash string      `json:"contentHash"`
+	Rows        []ReportRow `json:"rows"`
+	// Parts of the report which could not be built, not stored
+	Warnings []Warning `json:"-"`
 }
 
 type ReportRow struct {
@@ -28,14 +66,83 @@ type ReportRow struct {
 	Task      string    `json:"task"`
 	Link      string    `json:"link"`
 	TimeSpent float32   `json:"timeSpent"`
+	Source    string    `json:"source"`
 }
 
-type Channel struct {
-	Report Report
-	Err    error
+// Time range git actions are collected for, the start is inclusive and the end is exclusive
+type Period struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Kinds of report warnings
+const (
+	WarningCommitLinksUnavailable  = "commit_links_unavailable"
+	WarningMergeRequestUnavailable = "merge_request_unavailable"
+)
+
+// Part of the report built without some of the git data.
+// The report is still usable, so the user is only notified
+type Warning struct {
+	Kind string
+	// Host the data has been requested from
+	Source string
+	// Task of the affected row
+	Task   string
+	Reason string
 }
 
 type Result struct {
 	Name string
 	Data []byte
 }
+
+// Fingerprint of report rows as they have been generated from git data.
+// Equal hashes mean git data has not changed between generations
+func (r Report) Hash() string {
+	hash := sha256.New()
+	for _, row := range r.Rows {
+		fmt.Fprintf(hash, "%s\x1f%s\x1f%s\x1f%.4f\x1f%s\x1e",
+			row.Date.UTC().Format(time.RFC3339Nano), row.Task, row.Link, row.TimeSpent, row.Source)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Day containing the moment in the user's timezone
+func UserDay(user User, at time.Time) Period {
+	zone := user.Location()
+	local := at.In(zone)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, zone)
+
+	return Period{Start: start, End: start.AddDate(0, 0, 1)}
+}
+
+// Reports without a period cannot be matched with previous versions
+func (r Report) HasPeriod() bool {
+	return !r.PeriodStart.IsZero() && !r.PeriodEnd.IsZero()
+}
+
+// Fixed zone of the user's timezone offset
+func (u User) Location() *time.Location {
+	return time.FixedZone("", u.TimezoneOffset*60)
+}
+
+// Returns all accounts git activity should be collected from:
+// the primary one (gitlab id and token set on the user itself)
+// followed by linked accounts
+func (u User) SourceAccounts() []Account {
+	var result []Account
+
+	if u.GitlabId != 0 && u.UserToken != "" {
+		result = append(result, Account{
+			UserId:     u.Id,
+			Provider:   ProviderGitlab,
+			Host:       u.GitlabHost,
+			ExternalId: u.GitlabId,
+			Token:      u.UserToken,
+		})
+	}
+
+	return append(result, u.Accounts...)
+}
@@ -0,0 +1,28 @@
+package report
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserDay(t *testing.T) {
+	at := time.Date(2023, 10, 5, 22, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		offset int
+		want   time.Time
+	}{
+		{0, time.Date(2023, 10, 5, 0, 0, 0, 0, time.UTC)},
+		// 01:30 of the next day in UTC+3
+		{180, time.Date(2023, 10, 5, 21, 0, 0, 0, time.UTC)},
+		{-300, time.Date(2023, 10, 5, 5, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tests {
+		period := UserDay(User{TimezoneOffset: tc.offset}, at)
+
+		if !period.Start.Equal(tc.want) || !period.End.Equal(tc.want.Add(24*time.Hour)) {
+			t.Errorf("UserDay(offset %d) = %v - %v, want the day starting %v", tc.offset, period.Start, period.End, tc.want)
+		}
+	}
+}
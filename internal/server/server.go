@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/metrics"
+)
+
+const (
+	readinessTimeout = 5 * time.Second
+	shutdownTimeout  = 5 * time.Second
+)
+
+// Dependency which has to be available for the bot to serve users
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Serves health, readiness and metrics endpoints
+type Server struct {
+	http   *http.Server
+	checks []Check
+}
+
+func New(addr string, checks ...Check) *Server {
+	s := &Server{checks: checks}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/readyz", s.handleReadiness)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+
+	s.http = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	return s
+}
+
+// Serves requests until the context is done
+func (s *Server) Run(ctx context.Context) error {
+	errch := make(chan error, 1)
+	go func() {
+		slog.InfoContext(ctx, "http server listening", "addr", s.http.Addr)
+		errch <- s.http.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errch:
+		return fmt.Errorf("http server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := s.http.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("could not shut down http server: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Server) Handler() http.Handler {
+	return s.http.Handler
+}
+
+// Process is alive as long as it responds
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	status := http.StatusOK
+	results := make([]string, 0, len(s.checks))
+	for _, check := range s.checks {
+		if err := check.Check(ctx); err != nil {
+			slog.WarnContext(ctx, "readiness check failed", "check", check.Name, "reason", err)
+			status = http.StatusServiceUnavailable
+			results = append(results, fmt.Sprintf("%s: %v", check.Name, err))
+			continue
+		}
+
+		results = append(results, check.Name+": ok")
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	for _, result := range results {
+		fmt.Fprintln(w, result)
+	}
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.Default.Write(w); err != nil {
+		slog.WarnContext(r.Context(), "could not write metrics", "reason", err)
+	}
+}
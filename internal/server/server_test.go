@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEndpoints(t *testing.T) {
+	ok := Check{Name: "storage", Check: func(ctx context.Context) error { return nil }}
+	failing := Check{Name: "telegram", Check: func(ctx context.Context) error { return errors.New("unreachable") }}
+
+	tests := []struct {
+		name       string
+		checks     []Check
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"alive", []Check{failing}, "/healthz", http.StatusOK, "ok"},
+		{"ready", []Check{ok}, "/readyz", http.StatusOK, "storage: ok"},
+		{"not ready", []Check{ok, failing}, "/readyz", http.StatusServiceUnavailable, "telegram: unreachable"},
+		{"metrics", nil, "/metrics", http.StatusOK, "# TYPE bot_commands_total counter"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			New(":0", tc.checks...).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+
+			if !strings.Contains(rec.Body.String(), tc.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body.String(), tc.wantBody)
+			}
+		})
+	}
+}
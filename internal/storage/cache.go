@@ -0,0 +1,12 @@
+package storage
+
+import "time"
+
+// Gitlab API response kept to avoid fetching it again
+type CachedResponse struct {
+	Key  string
+	Body []byte
+	// Used to revalidate the response, empty when gitlab did not send it
+	ETag     string
+	StoredAt time.Time
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Encrypted values are stored as 'enc:v<key id>:<base64 of nonce and ciphertext>'
+const encryptedPrefix = "enc:v"
+
+var (
+	ErrUnknownKey       = errors.New("value is encrypted with unknown key")
+	ErrMalformedValue   = errors.New("encrypted value is malformed")
+	ErrNoActiveKey      = errors.New("active encryption key is not configured")
+	ErrMalformedKeyList = errors.New("encryption keys must be listed as 'id:base64_key' separated by commas")
+)
+
+// Encrypts secrets (e.g. gitlab tokens) before they are stored
+// using AES-GCM. Every value is tagged with an id of the key it was
+// encrypted with, so keys can be rotated without losing old data
+type TokenCipher struct {
+	keys        map[int]cipher.AEAD
+	activeKeyId int
+}
+
+// Keys are expected as 'id:base64_key' pairs separated by commas,
+// e.g. '1:MTIz...,2:NDU2...'. Every key must be 16, 24 or 32 bytes long
+func NewTokenCipher(rawKeys string, activeKeyId int) (*TokenCipher, error) {
+	keys := make(map[int]cipher.AEAD)
+
+	for _, rawKey := range strings.Split(rawKeys, ",") {
+		idPart, keyPart, found := strings.Cut(strings.TrimSpace(rawKey), ":")
+		if !found {
+			return nil, ErrMalformedKeyList
+		}
+
+		id, err := strconv.Atoi(idPart)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse key id %q: %w", idPart, err)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(keyPart)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode key %d: %w", id, err)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d: %w", id, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d: %w", id, err)
+		}
+
+		keys[id] = aead
+	}
+
+	if _, ok := keys[activeKeyId]; !ok {
+		return nil, ErrNoActiveKey
+	}
+
+	return &TokenCipher{
+		keys:        keys,
+		activeKeyId: activeKeyId,
+	}, nil
+}
+
+// Encrypts the value with the active key. Empty values are kept empty
+func (c *TokenCipher) Encrypt(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+
+	aead := c.keys[c.activeKeyId]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("could not generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	encoded := base64.StdEncoding.EncodeToString(sealed)
+
+	return fmt.Sprintf("%s%d:%s", encryptedPrefix, c.activeKeyId, encoded), nil
+}
+
+// Decrypts the value with the key it was encrypted with.
+// Values stored before encryption was introduced are returned as is
+func (c *TokenCipher) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	keyId, payload, err := splitEncrypted(value)
+	if err != nil {
+		return "", err
+	}
+
+	aead, ok := c.keys[keyId]
+	if !ok {
+		return "", fmt.Errorf("%w: %d", ErrUnknownKey, keyId)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrMalformedValue
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt value: %w", err)
+	}
+
+	return string(plain), nil
+}
+
+// Checks whether the value has to be re-encrypted with the active key
+func (c *TokenCipher) IsStale(value string) bool {
+	if value == "" {
+		return false
+	}
+
+	if !IsEncrypted(value) {
+		return true
+	}
+
+	keyId, _, err := splitEncrypted(value)
+	return err != nil || keyId != c.activeKeyId
+}
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+func splitEncrypted(value string) (int, string, error) {
+	rawKeyId, payload, found := strings.Cut(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if !found {
+		return 0, "", ErrMalformedValue
+	}
+
+	keyId, err := strconv.Atoi(rawKeyId)
+	if err != nil {
+		return 0, "", ErrMalformedValue
+	}
+
+	return keyId, payload, nil
+}
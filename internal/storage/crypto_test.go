@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Base64 encoded 32 byte keys
+const (
+	oldKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	newKey = "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+)
+
+func newTestCipher(t *testing.T, rawKeys string, activeKeyId int) *TokenCipher {
+	t.Helper()
+
+	c, err := NewTokenCipher(rawKeys, activeKeyId)
+	if err != nil {
+		t.Fatalf("NewTokenCipher() error = %v", err)
+	}
+
+	return c
+}
+
+func mustEncrypt(t *testing.T, c *TokenCipher, plain string) string {
+	t.Helper()
+
+	encrypted, err := c.Encrypt(plain)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	return encrypted
+}
+
+// Flips a bit of the ciphertext keeping the value well formed
+func tamper(t *testing.T, value string) string {
+	t.Helper()
+
+	keyId, payload, err := splitEncrypted(value)
+	if err != nil {
+		t.Fatalf("could not split encrypted value: %v", err)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		t.Fatalf("could not decode encrypted value: %v", err)
+	}
+	sealed[len(sealed)-1] ^= 1
+
+	return fmt.Sprintf("%s%d:%s", encryptedPrefix, keyId, base64.StdEncoding.EncodeToString(sealed))
+}
+
+func TestDecrypt(t *testing.T) {
+	oldCipher := newTestCipher(t, "1:"+oldKey, 1)
+	rotated := newTestCipher(t, "1:"+oldKey+",2:"+newKey, 2)
+	unknownKey := newTestCipher(t, "3:"+newKey, 3)
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+		errIs   error
+	}{
+		{name: "old key after rotation", value: mustEncrypt(t, oldCipher, "glpat-old"), want: "glpat-old"},
+		{name: "active key", value: mustEncrypt(t, rotated, "glpat-new"), want: "glpat-new"},
+		{name: "plain value", value: "glpat-plain", want: "glpat-plain"},
+		{name: "unknown key id", value: mustEncrypt(t, unknownKey, "glpat-unknown"), wantErr: true, errIs: ErrUnknownKey},
+		{name: "malformed key id", value: "enc:vx:AAAA", wantErr: true, errIs: ErrMalformedValue},
+		{name: "missing payload", value: "enc:v1", wantErr: true, errIs: ErrMalformedValue},
+		{name: "bad base64", value: "enc:v1:%%%", wantErr: true, errIs: ErrMalformedValue},
+		{name: "too short", value: "enc:v1:AAAA", wantErr: true, errIs: ErrMalformedValue},
+		{name: "tampered ciphertext", value: tamper(t, mustEncrypt(t, oldCipher, "glpat-old")), wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := rotated.Decrypt(tc.value)
+
+			if tc.wantErr {
+				if err == nil || (tc.errIs != nil && !errors.Is(err, tc.errIs)) {
+					t.Errorf("Decrypt() = %q, %v, want error %v", got, err, tc.errIs)
+				}
+				return
+			}
+
+			if err != nil || got != tc.want {
+				t.Errorf("Decrypt() = %q, %v, want %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsStale(t *testing.T) {
+	oldCipher := newTestCipher(t, "1:"+oldKey, 1)
+	rotated := newTestCipher(t, "1:"+oldKey+",2:"+newKey, 2)
+
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{name: "empty", value: "", want: false},
+		{name: "plain", value: "glpat-plain", want: true},
+		{name: "active key", value: mustEncrypt(t, rotated, "glpat-new"), want: false},
+		{name: "old key", value: mustEncrypt(t, oldCipher, "glpat-old"), want: true},
+		{name: "malformed", value: "enc:vx:AAAA", want: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := rotated.IsStale(tc.value); got != tc.want {
+				t.Errorf("IsStale(%q) = %v, want %v", tc.value, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEncryptUsesActiveKey(t *testing.T) {
+	rotated := newTestCipher(t, "1:"+oldKey+",2:"+newKey, 2)
+
+	encrypted := mustEncrypt(t, rotated, "glpat-new")
+	if !strings.HasPrefix(encrypted, encryptedPrefix+"2:") || strings.Contains(encrypted, "glpat-new") {
+		t.Errorf("Encrypt() = %q, want a value encrypted with key 2", encrypted)
+	}
+
+	if empty := mustEncrypt(t, rotated, ""); empty != "" {
+		t.Errorf("Encrypt() of empty value = %q, want it to stay empty", empty)
+	}
+}
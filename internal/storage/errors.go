@@ -3,5 +3,10 @@ package storage
 import "errors"
 
 var (
-	ErrUserNotFound = errors.New("User not found")
+	ErrUserNotFound    = errors.New("User not found")
+	ErrAccountNotFound = errors.New("Account not found")
+	ErrNotEmpty        = errors.New("Storage is not empty")
+	ErrCacheMiss       = errors.New("Response is not cached")
+	ErrReportNotFound  = errors.New("Report not found")
+	ErrArchiveNotFound = errors.New("Report archive not found")
 )
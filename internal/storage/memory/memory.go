@@ -0,0 +1,313 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BalanceBalls/report-generator/internal/report"
+	"github.com/BalanceBalls/report-generator/internal/storage"
+)
+
+// Storage keeping everything in process memory.
+// Data is lost on restart, meant for tests and local runs
+type MemoryStorage struct {
+	mu sync.RWMutex
+
+	users    map[int64]report.User
+	accounts map[int64]report.Account
+	reports  map[int64]report.Report
+	// Raw git data by report id
+	archives map[int64][]byte
+
+	lastAccountId int64
+	lastReportId  int64
+}
+
+func New() *MemoryStorage {
+	slog.Info("initializing in-memory storage...")
+
+	return &MemoryStorage{
+		users:    make(map[int64]report.User),
+		accounts: make(map[int64]report.Account),
+		reports:  make(map[int64]report.Report),
+		archives: make(map[int64][]byte),
+	}
+}
+
+func (s *MemoryStorage) Up(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStorage) AddUser(ctx context.Context, user report.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[user.Id]; exists {
+		return fmt.Errorf("could not add new user: user %d already exists", user.Id)
+	}
+
+	user.Reports = nil
+	user.Accounts = nil
+	s.users[user.Id] = user
+
+	return nil
+}
+
+func (s *MemoryStorage) UserExists(ctx context.Context, userId int64) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, exists := s.users[userId]
+	return exists
+}
+
+func (s *MemoryStorage) User(ctx context.Context, userId int64) (report.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, exists := s.users[userId]
+	if !exists {
+		return report.User{}, storage.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (s *MemoryStorage) UpdateUser(ctx context.Context, user report.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, exists := s.users[user.Id]
+	if !exists {
+		// Updating a missing row is not an error for SQL backends either
+		return nil
+	}
+
+	// Only the fields SQL backends update
+	stored.GitlabId = user.GitlabId
+	stored.UserEmail = user.UserEmail
+	stored.UserToken = user.UserToken
+	stored.TimezoneOffset = user.TimezoneOffset
+	stored.GitlabHost = user.GitlabHost
+	s.users[user.Id] = stored
+
+	return nil
+}
+
+// Removes the user along with their accounts and reports
+func (s *MemoryStorage) RemoveUser(ctx context.Context, userId int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.users, userId)
+
+	for id, account := range s.accounts {
+		if account.UserId == userId {
+			delete(s.accounts, id)
+		}
+	}
+
+	for id, r := range s.reports {
+		if r.UserId == userId {
+			delete(s.reports, id)
+			delete(s.archives, id)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) Accounts(ctx context.Context, userId int64) ([]report.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []report.Account{}
+	for _, account := range s.accounts {
+		if account.UserId == userId {
+			result = append(result, account)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+
+	return result, nil
+}
+
+func (s *MemoryStorage) AddAccount(ctx context.Context, account report.Account) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[account.UserId]; !exists {
+		return 0, fmt.Errorf("could not add account: %w", storage.ErrUserNotFound)
+	}
+
+	s.lastAccountId++
+	account.Id = s.lastAccountId
+	s.accounts[account.Id] = account
+
+	return account.Id, nil
+}
+
+func (s *MemoryStorage) RemoveAccount(ctx context.Context, userId int64, accountId int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, exists := s.accounts[accountId]
+	if !exists || account.UserId != userId {
+		return storage.ErrAccountNotFound
+	}
+
+	delete(s.accounts, accountId)
+	return nil
+}
+
+// Saves the report with its rows and returns the stored report.
+// A report regenerated for the same period becomes its new version when the rows differ
+// from the latest version. Otherwise the latest version is returned as is
+func (s *MemoryStorage) SaveReport(ctx context.Context, r report.Report, userId int64) (report.Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[userId]; !exists {
+		return report.Report{}, fmt.Errorf("could not save report: %w", storage.ErrUserNotFound)
+	}
+
+	saved := r
+	saved.UserId = userId
+	saved.Version = 1
+	saved.ContentHash = r.Hash()
+
+	if r.HasPeriod() {
+		if latest, found := s.latestVersion(userId, r.PeriodStart, r.PeriodEnd); found {
+			if latest.ContentHash == saved.ContentHash {
+				return copyReport(latest), nil
+			}
+			saved.Version = latest.Version + 1
+		}
+	}
+
+	s.lastReportId++
+	saved.Id = s.lastReportId
+	saved.Rows = make([]report.ReportRow, 0, len(r.Rows))
+
+	for _, row := range r.Rows {
+		row.ReportId = saved.Id
+		saved.Rows = append(saved.Rows, row)
+	}
+
+	s.reports[saved.Id] = saved
+	return copyReport(saved), nil
+}
+
+// Returns the latest version of every report of the user ordered by creation
+func (s *MemoryStorage) Reports(ctx context.Context, userId int64) ([]report.Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []report.Report{}
+	for _, r := range s.reports {
+		if r.UserId != userId {
+			continue
+		}
+
+		if r.HasPeriod() {
+			if latest, _ := s.latestVersion(userId, r.PeriodStart, r.PeriodEnd); latest.Id != r.Id {
+				continue
+			}
+		}
+
+		result = append(result, copyReport(r))
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+
+	return result, nil
+}
+
+// Returns every version of the user's report for the period ordered by version
+func (s *MemoryStorage) ReportVersions(
+	ctx context.Context, userId int64, periodStart time.Time, periodEnd time.Time,
+) ([]report.Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []report.Report{}
+	for _, r := range s.reports {
+		if r.UserId == userId && samePeriod(r, periodStart, periodEnd) {
+			result = append(result, copyReport(r))
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+
+	return result, nil
+}
+
+// Replaces raw git data of the report
+func (s *MemoryStorage) SaveReportArchive(ctx context.Context, reportId int64, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.reports[reportId]; !exists {
+		return fmt.Errorf("could not save report archive: %w", storage.ErrReportNotFound)
+	}
+
+	s.archives[reportId] = append([]byte(nil), data...)
+	return nil
+}
+
+// Returns raw git data of the user's report
+func (s *MemoryStorage) ReportArchive(ctx context.Context, userId int64, reportId int64) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, exists := s.archives[reportId]
+	if !exists || s.reports[reportId].UserId != userId {
+		return nil, storage.ErrArchiveNotFound
+	}
+
+	return append([]byte(nil), data...), nil
+}
+
+// Must be called with the lock held
+func (s *MemoryStorage) latestVersion(userId int64, periodStart time.Time, periodEnd time.Time) (report.Report, bool) {
+	var latest report.Report
+	found := false
+
+	for _, r := range s.reports {
+		if r.UserId != userId || !samePeriod(r, periodStart, periodEnd) {
+			continue
+		}
+
+		if !found || r.Version > latest.Version {
+			latest = r
+			found = true
+		}
+	}
+
+	return latest, found
+}
+
+func samePeriod(r report.Report, periodStart time.Time, periodEnd time.Time) bool {
+	return r.PeriodStart.Equal(periodStart) && r.PeriodEnd.Equal(periodEnd)
+}
+
+// Callers must not be able to modify stored rows
+func copyReport(r report.Report) report.Report {
+	r.Rows = append([]report.ReportRow(nil), r.Rows...)
+	return r
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/BalanceBalls/report-generator/internal/bot"
+	"github.com/BalanceBalls/report-generator/internal/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) bot.Storage {
+		return New()
+	})
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Schema change applied to a database once.
+// Loaded from files named as '<version>_<name>.sql', e.g. '0002_linked_accounts.sql'
+type Migration struct {
+	Version int
+	Name    string
+	Script  string
+}
+
+// Reads migrations from the directory ordered by version
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read migrations directory: %w", err)
+	}
+
+	result := make([]Migration, 0, len(entries))
+	versions := make(map[int]string, len(entries))
+
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || path.Ext(fileName) != ".sql" {
+			continue
+		}
+
+		rawVersion, name, found := strings.Cut(strings.TrimSuffix(fileName, ".sql"), "_")
+		if !found {
+			return nil, fmt.Errorf("migration file %q is not named as '<version>_<name>.sql'", fileName)
+		}
+
+		version, err := strconv.Atoi(rawVersion)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse version of migration %q: %w", fileName, err)
+		}
+
+		if duplicate, exists := versions[version]; exists {
+			return nil, fmt.Errorf("migrations %q and %q share version %d", duplicate, fileName, version)
+		}
+		versions[version] = fileName
+
+		script, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if err != nil {
+			return nil, fmt.Errorf("could not read migration %q: %w", fileName, err)
+		}
+
+		result = append(result, Migration{
+			Version: version,
+			Name:    name,
+			Script:  string(script),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+
+	return result, nil
+}
+
+// Returns migrations which versions are not among applied ones
+func PendingMigrations(migrations []Migration, applied map[int]bool) []Migration {
+	var result []Migration
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			result = append(result, migration)
+		}
+	}
+
+	return result
+}
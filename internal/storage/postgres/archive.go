@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/BalanceBalls/report-generator/internal/storage"
+)
+
+// Replaces raw git data of the report
+func (s *PostgresStorage) SaveReportArchive(ctx context.Context, reportId int64, data []byte) error {
+	res, err := s.db.ExecContext(ctx, saveReportArchive, reportId, data)
+	if err != nil {
+		return fmt.Errorf("could not save report archive: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not save report archive: %w", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("could not save report archive: %w", storage.ErrReportNotFound)
+	}
+
+	return nil
+}
+
+// Returns raw git data of the user's report
+func (s *PostgresStorage) ReportArchive(ctx context.Context, userId int64, reportId int64) ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, getReportArchive, userId, reportId).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrArchiveNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch report archive: %w", err)
+	}
+
+	return data, nil
+}
+
+func snapshotArchives(ctx context.Context, tx *sql.Tx) ([]storage.ReportArchive, error) {
+	rows, err := tx.QueryContext(ctx, getAllReportArchives)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch report archives: %w", err)
+	}
+	defer rows.Close()
+
+	archives := []storage.ReportArchive{}
+	for rows.Next() {
+		archive := storage.ReportArchive{}
+		if err := rows.Scan(&archive.ReportId, &archive.Data); err != nil {
+			return nil, fmt.Errorf("failed to fetch report archive: %w", err)
+		}
+
+		archives = append(archives, archive)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch report archives: %w", err)
+	}
+
+	return archives, nil
+}
@@ -0,0 +1,163 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/BalanceBalls/report-generator/internal/report"
+	"github.com/BalanceBalls/report-generator/internal/storage"
+)
+
+// Reads everything stored within a single transaction, tokens are left encrypted
+func (s *PostgresStorage) Snapshot(ctx context.Context) (storage.Snapshot, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return storage.Snapshot{}, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	users, err := snapshotUsers(ctx, tx)
+	if err != nil {
+		return storage.Snapshot{}, err
+	}
+
+	rows, err := tx.QueryContext(ctx, getAllReports)
+	if err != nil {
+		return storage.Snapshot{}, fmt.Errorf("could not fetch reports: %w", err)
+	}
+
+	reports, err := collectReports(rows)
+	if err != nil {
+		return storage.Snapshot{}, err
+	}
+
+	archives, err := snapshotArchives(ctx, tx)
+	if err != nil {
+		return storage.Snapshot{}, err
+	}
+
+	return storage.Snapshot{Users: users, Reports: reports, Archives: archives}, nil
+}
+
+// Loads the snapshot into the empty storage keeping ids of every record
+func (s *PostgresStorage) Restore(ctx context.Context, snapshot storage.Snapshot) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var isEmpty bool
+	if err := tx.QueryRowContext(ctx, checkStorageIsEmpty).Scan(&isEmpty); err != nil {
+		return fmt.Errorf("could not check storage is empty: %w", err)
+	}
+
+	if !isEmpty {
+		return storage.ErrNotEmpty
+	}
+
+	for _, user := range snapshot.Users {
+		_, err := tx.ExecContext(ctx, addUser,
+			user.Id, user.GitlabId, user.UserEmail, user.UserToken, user.TimezoneOffset, user.IsActive, user.GitlabHost)
+		if err != nil {
+			return fmt.Errorf("could not restore user %d: %w", user.Id, err)
+		}
+
+		for _, account := range user.Accounts {
+			_, err := tx.ExecContext(ctx, restoreAccount,
+				account.Id, account.UserId, account.Provider, account.Host, account.ExternalId, account.Token)
+			if err != nil {
+				return fmt.Errorf("could not restore account %d: %w", account.Id, err)
+			}
+		}
+	}
+
+	for _, r := range snapshot.Reports {
+		_, err := tx.ExecContext(ctx, restoreReport,
+			r.Id, r.UserId, nullTime(r.PeriodStart), nullTime(r.PeriodEnd), r.Source, r.Format, r.Version, r.ContentHash)
+		if err != nil {
+			return fmt.Errorf("could not restore report %d: %w", r.Id, err)
+		}
+
+		for _, row := range r.Rows {
+			_, err := tx.ExecContext(ctx, addRow, r.Id, row.Date, row.Task, row.Link, row.TimeSpent, row.Source)
+			if err != nil {
+				return fmt.Errorf("could not restore row of report %d: %w", r.Id, err)
+			}
+		}
+	}
+
+	for _, archive := range snapshot.Archives {
+		if _, err := tx.ExecContext(ctx, restoreReportArchive, archive.ReportId, archive.Data); err != nil {
+			return fmt.Errorf("could not restore archive of report %d: %w", archive.ReportId, err)
+		}
+	}
+
+	for _, resetQuery := range []string{resetAccountsSequence, resetReportsSequence} {
+		if _, err := tx.ExecContext(ctx, resetQuery); err != nil {
+			return fmt.Errorf("could not reset id sequence: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func snapshotUsers(ctx context.Context, tx *sql.Tx) ([]report.User, error) {
+	userRows, err := tx.QueryContext(ctx, getAllUsers)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch users: %w", err)
+	}
+	defer userRows.Close()
+
+	users := []report.User{}
+	index := make(map[int64]int)
+	for userRows.Next() {
+		user := report.User{}
+		err := userRows.Scan(
+			&user.Id, &user.GitlabId, &user.UserEmail, &user.UserToken, &user.TimezoneOffset, &user.IsActive, &user.GitlabHost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch user: %w", err)
+		}
+
+		index[user.Id] = len(users)
+		users = append(users, user)
+	}
+
+	if err := userRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %w", err)
+	}
+
+	accountRows, err := tx.QueryContext(ctx, getAllAccounts)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch accounts: %w", err)
+	}
+	defer accountRows.Close()
+
+	for accountRows.Next() {
+		account := report.Account{}
+		err := accountRows.Scan(
+			&account.Id, &account.UserId, &account.Provider, &account.Host, &account.ExternalId, &account.Token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch account: %w", err)
+		}
+
+		if i, ok := index[account.UserId]; ok {
+			users[i].Accounts = append(users[i].Accounts, account)
+		}
+	}
+
+	if err := accountRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch accounts: %w", err)
+	}
+
+	return users, nil
+}
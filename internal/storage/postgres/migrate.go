@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"log/slog"
+
+	"github.com/BalanceBalls/report-generator/internal/storage"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Arbitrary key of the advisory lock held while migrations are applied,
+// so only one bot instance migrates the database at a time
+const migrationsLockKey int64 = 7_245_113_001
+
+// Applies pending migrations in order, each one in its own transaction
+func (s *PostgresStorage) Migrate(ctx context.Context) error {
+	migrations, err := storage.LoadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return err
+	}
+
+	// Advisory locks belong to a session, so every
+	// statement has to go through the same connection
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("could not acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, acquireMigrationsLock, migrationsLockKey); err != nil {
+		return fmt.Errorf("could not acquire migrations lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx), releaseMigrationsLock, migrationsLockKey); err != nil {
+			slog.ErrorContext(ctx, "could not release migrations lock", "reason", err)
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, createSchemaMigrationsTable); err != nil {
+		return fmt.Errorf("could not create table schema_migrations: %w", err)
+	}
+
+	// Read applied versions only after the lock is held,
+	// another instance might have just finished migrating
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range storage.PendingMigrations(migrations, applied) {
+		if err := applyMigration(ctx, conn, migration); err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		slog.InfoContext(ctx, "migration applied", "version", migration.Version, "name", migration.Name)
+	}
+
+	return nil
+}
+
+// Returns migrations which have not been applied to the database yet
+func (s *PostgresStorage) PendingMigrations(ctx context.Context) ([]storage.Migration, error) {
+	migrations, err := storage.LoadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var tableExists bool
+	if err := s.db.QueryRowContext(ctx, checkSchemaMigrationsExists).Scan(&tableExists); err != nil {
+		return nil, fmt.Errorf("could not check table schema_migrations: %w", err)
+	}
+
+	if !tableExists {
+		return migrations, nil
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.PendingMigrations(migrations, applied), nil
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(ctx, getAppliedMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("failed to fetch row: %w", err)
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, migration storage.Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, migration.Script); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, addAppliedMigration, migration.Version, migration.Name); err != nil {
+		return fmt.Errorf("could not record migration: %w", err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,26 @@
+-- Tables may already exist in databases created before migrations were introduced
+CREATE TABLE IF NOT EXISTS users (
+  id                INTEGER PRIMARY KEY,
+  gitlab_id         INTEGER,
+  user_email        TEXT,
+  user_token        TEXT,
+  timezone_offset   INTEGER,
+  is_active         BOOLEAN
+);
+
+CREATE TABLE IF NOT EXISTS reports (
+  id      SERIAL PRIMARY KEY,
+  user_id INTEGER,
+
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS rows (
+  report_id   INTEGER,
+  date        TEXT,
+  task        TEXT,
+  link        TEXT,
+  time_spent  REAL,
+
+  FOREIGN KEY(report_id) REFERENCES reports(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
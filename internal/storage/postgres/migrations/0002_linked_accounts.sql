@@ -0,0 +1,12 @@
+ALTER TABLE rows ADD COLUMN IF NOT EXISTS source TEXT;
+
+CREATE TABLE IF NOT EXISTS accounts (
+  id           SERIAL PRIMARY KEY,
+  user_id      INTEGER,
+  provider     TEXT,
+  host         TEXT,
+  external_id  INTEGER,
+  token        TEXT,
+
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
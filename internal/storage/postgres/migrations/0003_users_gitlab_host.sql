@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS gitlab_host TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- Dates have been stored as text in formats Postgres is able to cast
+ALTER TABLE rows
+  ALTER COLUMN date TYPE TIMESTAMPTZ USING date::timestamptz,
+  ALTER COLUMN time_spent TYPE NUMERIC(8, 2);
+
+-- Period is unknown for reports saved earlier
+ALTER TABLE reports
+  ADD COLUMN period_start TIMESTAMPTZ,
+  ADD COLUMN period_end   TIMESTAMPTZ,
+  ADD COLUMN source       TEXT NOT NULL DEFAULT '',
+  ADD COLUMN format       TEXT NOT NULL DEFAULT '';
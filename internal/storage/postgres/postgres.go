@@ -16,10 +16,11 @@ import (
 )
 
 type PostgresStorage struct {
-	db *sql.DB
+	db     *sql.DB
+	cipher *storage.TokenCipher
 }
 
-func New(connectionString string) (*PostgresStorage, error) {
+func New(connectionString string, cipher *storage.TokenCipher) (*PostgresStorage, error) {
 	slog.Info("initializing Postgres DB...")
 	db, err := sql.Open("postgres", connectionString)
 
@@ -31,31 +32,45 @@ func New(connectionString string) (*PostgresStorage, error) {
 		return nil, fmt.Errorf("could not access database: %w", err)
 	}
 
-	return &PostgresStorage{db: db}, nil
+	return &PostgresStorage{db: db, cipher: cipher}, nil
+}
+
+func (s *PostgresStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *PostgresStorage) Close() error {
+	return s.db.Close()
 }
 
 func (s *PostgresStorage) Up(ctx context.Context) error {
-	_, err := s.db.ExecContext(ctx, createUsersTable)
-	if err != nil {
-		return fmt.Errorf("could not create table users: %w", err)
+	if err := s.Migrate(ctx); err != nil {
+		return fmt.Errorf("could not migrate database: %w", err)
 	}
 
-	_, err = s.db.Exec(createReportsTable)
+	// Tokens stored before encryption was introduced
+	encrypted, err := s.reencryptTokens(ctx, func(token string) bool {
+		return token != "" && !storage.IsEncrypted(token)
+	})
 	if err != nil {
-		return fmt.Errorf("could not create table reports: %w", err)
+		return fmt.Errorf("could not encrypt stored tokens: %w", err)
 	}
 
-	_, err = s.db.Exec(createRowsTable)
-	if err != nil {
-		return fmt.Errorf("could not create table reports: %w", err)
+	if encrypted > 0 {
+		slog.InfoContext(ctx, "plain text tokens have been encrypted", "count", encrypted)
 	}
 
 	return nil
 }
 
 func (s *PostgresStorage) AddUser(ctx context.Context, user report.User) error {
-	_, err := s.db.ExecContext(ctx, addUser,
-		user.Id, user.GitlabId, user.UserEmail, user.UserToken, user.TimezoneOffset, user.IsActive)
+	token, err := s.cipher.Encrypt(user.UserToken)
+	if err != nil {
+		return fmt.Errorf("could not encrypt user token: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, addUser,
+		user.Id, user.GitlabId, user.UserEmail, token, user.TimezoneOffset, user.IsActive, user.GitlabHost)
 	if err != nil {
 		return fmt.Errorf("could not add new user: %w", err)
 	}
@@ -94,7 +109,8 @@ func (s *PostgresStorage) User(ctx context.Context, userId int64) (report.User,
 	}
 
 	user := report.User{}
-	err = q.QueryRowContext(ctx, userId).Scan(&user.Id, &user.GitlabId, &user.UserEmail, &user.UserToken, &user.IsActive)
+	err = q.QueryRowContext(ctx, userId).Scan(
+		&user.Id, &user.GitlabId, &user.UserEmail, &user.UserToken, &user.TimezoneOffset, &user.IsActive, &user.GitlabHost)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -104,11 +120,22 @@ func (s *PostgresStorage) User(ctx context.Context, userId int64) (report.User,
 		return report.User{}, fmt.Errorf("failed to fetch row: %w", err)
 	}
 
+	user.UserToken, err = s.cipher.Decrypt(user.UserToken)
+	if err != nil {
+		return report.User{}, fmt.Errorf("could not decrypt user token: %w", err)
+	}
+
 	return user, nil
 }
 
 func (s *PostgresStorage) UpdateUser(ctx context.Context, user report.User) error {
-	_, err := s.db.ExecContext(ctx, updateUser, user.GitlabId, user.UserEmail, user.UserToken, user.TimezoneOffset, user.Id)
+	token, err := s.cipher.Encrypt(user.UserToken)
+	if err != nil {
+		return fmt.Errorf("could not encrypt user token: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, updateUser,
+		user.GitlabId, user.UserEmail, token, user.TimezoneOffset, user.GitlabHost, user.Id)
 	if err != nil {
 		return fmt.Errorf("could not update user: %w", err)
 	}
@@ -125,35 +152,234 @@ func (s *PostgresStorage) RemoveUser(ctx context.Context, userId int64) error {
 	return nil
 }
 
-func (s *PostgresStorage) SaveReport(ctx context.Context, report report.Report, userId int64) error {
-	lastInsertId := 0
-	err := s.db.QueryRowContext(ctx, addReport, userId).Scan(&lastInsertId)
+func (s *PostgresStorage) Accounts(ctx context.Context, userId int64) ([]report.Account, error) {
+	rows, err := s.db.QueryContext(ctx, getAccountsByUserId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch accounts: %w", err)
+	}
+	defer rows.Close()
+
+	result := []report.Account{}
+	for rows.Next() {
+		account := report.Account{}
+		err := rows.Scan(&account.Id, &account.UserId, &account.Provider, &account.Host, &account.ExternalId, &account.Token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch row: %w", err)
+		}
+
+		account.Token, err = s.cipher.Decrypt(account.Token)
+		if err != nil {
+			return nil, fmt.Errorf("could not decrypt account token: %w", err)
+		}
+
+		result = append(result, account)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch accounts: %w", err)
+	}
+
+	return result, nil
+}
 
+func (s *PostgresStorage) AddAccount(ctx context.Context, account report.Account) (int64, error) {
+	token, err := s.cipher.Encrypt(account.Token)
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("could not encrypt account token: %w", err)
 	}
 
-	columnsCnt := 5
-	values := make([]interface{}, 0, len(report.Rows)*columnsCnt)
-	query := addRows
-	for i, reportRow := range report.Rows {
-		query += fmt.Sprintf("($%d, $%d, $%d, $%d, $%d),",
-			columnsCnt*i+1, columnsCnt*i+2, columnsCnt*i+3, columnsCnt*i+4, columnsCnt*i+5)
-	
-		values = append(values, lastInsertId, reportRow.Date, reportRow.Task, reportRow.Link, reportRow.TimeSpent)
+	var id int64
+	err = s.db.QueryRowContext(ctx, addAccount,
+		account.UserId, account.Provider, account.Host, account.ExternalId, token).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("could not add account: %w", err)
 	}
 
-	// Trim comma at the end
-	query = query[:len(query)-1]
+	return id, nil
+}
+
+func (s *PostgresStorage) RemoveAccount(ctx context.Context, userId int64, accountId int64) error {
+	res, err := s.db.ExecContext(ctx, removeAccount, accountId, userId)
+	if err != nil {
+		return fmt.Errorf("could not remove account: %w", err)
+	}
 
-	_, err = s.db.Exec(query, values...)
+	affected, err := res.RowsAffected()
 	if err != nil {
-		return err
+		return fmt.Errorf("could not remove account: %w", err)
+	}
+
+	if affected == 0 {
+		return storage.ErrAccountNotFound
 	}
 
 	return nil
 }
 
+// Saves the report with its rows in a single transaction and returns the stored report.
+// A report regenerated for the same period becomes its new version when the rows differ
+// from the latest version. Otherwise the latest version is returned as is, keeping its manual edits
+func (s *PostgresStorage) SaveReport(ctx context.Context, r report.Report, userId int64) (report.Report, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return report.Report{}, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	r.Version = 1
+	r.ContentHash = r.Hash()
+
+	if r.HasPeriod() {
+		var locked int
+		if err := tx.QueryRowContext(ctx, lockUser, userId).Scan(&locked); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return report.Report{}, storage.ErrUserNotFound
+			}
+			return report.Report{}, fmt.Errorf("could not lock user: %w", err)
+		}
+
+		var latestId int64
+		var latestVersion int
+		var latestHash string
+		err := tx.QueryRowContext(ctx, getLatestReportVersion, userId, r.PeriodStart, r.PeriodEnd).
+			Scan(&latestId, &latestVersion, &latestHash)
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return report.Report{}, fmt.Errorf("could not fetch latest report version: %w", err)
+		case latestHash == r.ContentHash:
+			return s.reportById(ctx, tx, latestId)
+		default:
+			r.Version = latestVersion + 1
+		}
+	}
+
+	var reportId int64
+	err = tx.QueryRowContext(ctx, addReport,
+		userId, nullTime(r.PeriodStart), nullTime(r.PeriodEnd), r.Source, r.Format, r.Version, r.ContentHash).Scan(&reportId)
+	if err != nil {
+		return report.Report{}, fmt.Errorf("could not add report: %w", err)
+	}
+
+	if len(r.Rows) > 0 {
+		stmt, err := tx.PrepareContext(ctx, addRow)
+		if err != nil {
+			return report.Report{}, fmt.Errorf("failed to build query: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, reportRow := range r.Rows {
+			_, err := stmt.ExecContext(ctx,
+				reportId, reportRow.Date, reportRow.Task, reportRow.Link, reportRow.TimeSpent, reportRow.Source)
+			if err != nil {
+				return report.Report{}, fmt.Errorf("could not add report row: %w", err)
+			}
+		}
+	}
+
+	saved, err := s.reportById(ctx, tx, reportId)
+	if err != nil {
+		return report.Report{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return report.Report{}, fmt.Errorf("could not commit transaction: %w", err)
+	}
+
+	return saved, nil
+}
+
+// Returns the latest version of every report of the user ordered by creation
+func (s *PostgresStorage) Reports(ctx context.Context, userId int64) ([]report.Report, error) {
+	rows, err := s.db.QueryContext(ctx, getReportsByUserId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch reports: %w", err)
+	}
+
+	return collectReports(rows)
+}
+
+// Returns every version of the user's report for the period ordered by version
+func (s *PostgresStorage) ReportVersions(
+	ctx context.Context, userId int64, periodStart time.Time, periodEnd time.Time,
+) ([]report.Report, error) {
+	rows, err := s.db.QueryContext(ctx, getReportVersions, userId, periodStart, periodEnd)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch report versions: %w", err)
+	}
+
+	return collectReports(rows)
+}
+
+func (s *PostgresStorage) reportById(ctx context.Context, tx *sql.Tx, reportId int64) (report.Report, error) {
+	rows, err := tx.QueryContext(ctx, getReportById, reportId)
+	if err != nil {
+		return report.Report{}, fmt.Errorf("could not fetch report: %w", err)
+	}
+
+	reports, err := collectReports(rows)
+	if err != nil {
+		return report.Report{}, err
+	}
+
+	if len(reports) == 0 {
+		return report.Report{}, fmt.Errorf("report %d has not been found", reportId)
+	}
+
+	return reports[0], nil
+}
+
+// Groups joined report and row records into reports, closes rows
+func collectReports(rows *sql.Rows) ([]report.Report, error) {
+	defer rows.Close()
+
+	result := []report.Report{}
+	for rows.Next() {
+		var header report.Report
+		var periodStart, periodEnd, date sql.NullTime
+		var task, link, source sql.NullString
+		var timeSpent sql.NullFloat64
+
+		err := rows.Scan(
+			&header.Id, &header.UserId, &periodStart, &periodEnd, &header.Source, &header.Format,
+			&header.Version, &header.ContentHash,
+			&date, &task, &link, &timeSpent, &source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch row: %w", err)
+		}
+
+		if len(result) == 0 || result[len(result)-1].Id != header.Id {
+			header.PeriodStart = periodStart.Time
+			header.PeriodEnd = periodEnd.Time
+			result = append(result, header)
+		}
+
+		// Report without rows
+		if !date.Valid {
+			continue
+		}
+
+		current := &result[len(result)-1]
+		current.Rows = append(current.Rows, report.ReportRow{
+			ReportId:  header.Id,
+			Date:      date.Time,
+			Task:      task.String,
+			Link:      link.String,
+			TimeSpent: float32(timeSpent.Float64),
+			Source:    source.String,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch reports: %w", err)
+	}
+
+	return result, nil
+}
+
 func (s *PostgresStorage) Users(ctx context.Context) ([]storage.FlatUser, error) {
 	rows, err := s.db.QueryContext(ctx, getFullUsers, 10, 0)
 
@@ -170,24 +396,29 @@ func (s *PostgresStorage) Users(ctx context.Context) ([]storage.FlatUser, error)
 	for rows.Next() {
 		tFlatUser := storage.FlatUser{}
 
-		var rawDate string
+		var source sql.NullString
 		err := rows.Scan(
 			&tFlatUser.Id, &tFlatUser.GitlabId, &tFlatUser.UserEmail, &tFlatUser.UserToken, &tFlatUser.IsActive,
 			&tFlatUser.ReportId, &tFlatUser.UserId,
-			&tFlatUser.ReportRowId, &rawDate, &tFlatUser.Task, &tFlatUser.Link, &tFlatUser.TimeSpent)
+			&tFlatUser.ReportRowId, &tFlatUser.Date, &tFlatUser.Task, &tFlatUser.Link, &tFlatUser.TimeSpent, &source)
 
 		if err != nil {
 			return []storage.FlatUser{}, err
 		}
 
-		rowDateParsed, dateErr := time.Parse(time.RFC3339, rawDate)
-		if dateErr != nil {
+		tFlatUser.UserToken, err = s.cipher.Decrypt(tFlatUser.UserToken)
+		if err != nil {
 			return []storage.FlatUser{}, err
 		}
 
-		tFlatUser.Date = rowDateParsed
+		tFlatUser.Source = source.String
 		result = append(result, tFlatUser)
 	}
 
 	return result, nil
 }
+
+// Zero time is stored as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -1,56 +1,93 @@
 package postgres
 
 const (
-	createUsersTable = `
-CREATE TABLE IF NOT EXISTS users (
-  id                INTEGER PRIMARY KEY,
-  gitlab_id         INTEGER,
-  user_email        TEXT,
-  user_token        TEXT,
-  timezone_offset   INTEGER,
-  is_active         BOOLEAN
+	createSchemaMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  version     INTEGER PRIMARY KEY,
+  name        TEXT NOT NULL,
+  applied_at  TIMESTAMPTZ NOT NULL DEFAULT now()
 )`
 
-	createReportsTable = `
-CREATE TABLE IF NOT EXISTS reports (
-  id      SERIAL PRIMARY KEY,
-  user_id INTEGER,
+	checkSchemaMigrationsExists = `
+SELECT to_regclass('schema_migrations') IS NOT NULL
+	`
 
-  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE
-)`
+	getAppliedMigrations = `
+SELECT version FROM schema_migrations
+	`
 
-	createRowsTable = `
-CREATE TABLE IF NOT EXISTS rows (
-  report_id   INTEGER,
-  date        TEXT,
-  task        TEXT,
-  link        TEXT,
-  time_spent  REAL,
+	addAppliedMigration = `
+INSERT INTO schema_migrations (version, name) VALUES ($1, $2)
+	`
 
-  FOREIGN KEY(report_id) REFERENCES reports(id) ON DELETE CASCADE ON UPDATE CASCADE
-)`
+	acquireMigrationsLock = `
+SELECT pg_advisory_lock($1)
+	`
+
+	releaseMigrationsLock = `
+SELECT pg_advisory_unlock($1)
+	`
 
 	getFullUsers = `
 SELECT 
   u.id, u.gitlab_id, u.user_email, u.user_token, u.is_active,
   r.id, r.user_id, 
-  ro.report_id, ro.date, ro.task, ro.link, ro.time_spent
+  ro.report_id, ro.date, ro.task, ro.link, ro.time_spent, ro.source
 FROM users u 
   INNER JOIN reports r on r.user_id = u.id
   INNER JOIN rows ro on ro.report_id = r.id
 LIMIT $1
 OFFSET $2`
 
+	selectReports = `
+SELECT 
+  r.id, r.user_id, r.period_start, r.period_end, r.source, r.format, r.version, r.content_hash,
+  ro.date, ro.task, ro.link, ro.time_spent, ro.source
+FROM reports r
+  LEFT JOIN rows ro on ro.report_id = r.id
+`
+
+	// Only the latest version of every period
+	getReportsByUserId = selectReports + `
+WHERE r.user_id = $1 AND NOT EXISTS (
+  SELECT 1 FROM reports newer
+  WHERE newer.user_id = r.user_id
+    AND newer.period_start = r.period_start
+    AND newer.period_end = r.period_end
+    AND newer.version > r.version
+)
+ORDER BY r.id, ro.date`
+
+	getReportVersions = selectReports + `
+WHERE r.user_id = $1 AND r.period_start = $2 AND r.period_end = $3
+ORDER BY r.version, ro.date`
+
+	getReportById = selectReports + `
+WHERE r.id = $1
+ORDER BY ro.date`
+
+	getLatestReportVersion = `
+SELECT id, version, content_hash FROM reports
+WHERE user_id = $1 AND period_start = $2 AND period_end = $3
+ORDER BY version DESC
+LIMIT 1
+	`
+
+	// Serializes saving reports of a single user
+	lockUser = `
+SELECT 1 FROM users WHERE id = $1 FOR UPDATE
+	`
+
 	getUserById = `
 SELECT 
-  id, gitlab_id, user_email, user_token, is_active 
+  id, gitlab_id, user_email, user_token, timezone_offset, is_active, gitlab_host 
 FROM users 
 WHERE id = $1
   `
 
 	addUser = `
-INSERT INTO users (id, gitlab_id, user_email, user_token, timezone_offset, is_active) 
-VALUES ($1, $2, $3, $4, $5, $6)
+INSERT INTO users (id, gitlab_id, user_email, user_token, timezone_offset, is_active, gitlab_host) 
+VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
 
 	updateUser = `
@@ -58,8 +95,9 @@ UPDATE users SET
 	gitlab_id = $1,
 	user_email = $2,
 	user_token = $3,
-	timezone_offset = $4
-WHERE id = $5
+	timezone_offset = $4,
+	gitlab_host = $5
+WHERE id = $6
 	`
 
 	removeUser = `
@@ -73,10 +111,129 @@ WHERE id = $1
 	`
 
 	addReport = `
-INSERT INTO reports (user_id) VALUES ($1) RETURNING id
+INSERT INTO reports (user_id, period_start, period_end, source, format, version, content_hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id
+	`
+
+	addRow = `
+INSERT INTO rows (report_id, date, task, link, time_spent, source)
+VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	getAccountsByUserId = `
+SELECT 
+  id, user_id, provider, host, external_id, token
+FROM accounts
+WHERE user_id = $1
+ORDER BY id
+	`
+
+	addAccount = `
+INSERT INTO accounts (user_id, provider, host, external_id, token)
+VALUES ($1, $2, $3, $4, $5) RETURNING id
+	`
+
+	getUserTokensForUpdate = `
+SELECT id, user_token FROM users
+WHERE user_token <> ''
+FOR UPDATE
+	`
+
+	updateUserToken = `
+UPDATE users SET user_token = $1 WHERE id = $2
+	`
+
+	getAccountTokensForUpdate = `
+SELECT id, token FROM accounts
+WHERE token <> ''
+FOR UPDATE
+	`
+
+	updateAccountToken = `
+UPDATE accounts SET token = $1 WHERE id = $2
+	`
+
+	removeAccount = `
+DELETE FROM accounts
+WHERE id = $1 AND user_id = $2
+	`
+)
+
+// Backups
+const (
+	getAllUsers = `
+SELECT 
+  id, COALESCE(gitlab_id, 0), COALESCE(user_email, ''), COALESCE(user_token, ''),
+  COALESCE(timezone_offset, 0), COALESCE(is_active, false), gitlab_host
+FROM users
+ORDER BY id`
+
+	getAllAccounts = `
+SELECT 
+  id, user_id, provider, host, external_id, token
+FROM accounts
+ORDER BY id`
+
+	getAllReports = selectReports + `
+ORDER BY r.id, ro.date`
+
+	checkStorageIsEmpty = `
+SELECT NOT EXISTS (SELECT 1 FROM users) AND NOT EXISTS (SELECT 1 FROM reports)
+	`
+
+	restoreAccount = `
+INSERT INTO accounts (id, user_id, provider, host, external_id, token)
+VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	restoreReport = `
+INSERT INTO reports (id, user_id, period_start, period_end, source, format, version, content_hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	// Ids are restored as is, so sequences have to continue after them
+	resetAccountsSequence = `
+SELECT setval(pg_get_serial_sequence('accounts', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM accounts
+	`
+
+	resetReportsSequence = `
+SELECT setval(pg_get_serial_sequence('reports', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM reports
+	`
+)
+
+// Gitlab responses cache
+const (
+	getCachedResponse = `
+SELECT body, etag, stored_at FROM gitlab_cache WHERE key = $1
+	`
+
+	saveCachedResponse = `
+INSERT INTO gitlab_cache (key, body, etag, stored_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (key) DO UPDATE SET body = EXCLUDED.body, etag = EXCLUDED.etag, stored_at = EXCLUDED.stored_at
+	`
+)
+
+// Raw git data of reports
+const (
+	saveReportArchive = `
+INSERT INTO report_archives (report_id, data)
+SELECT id, $2 FROM reports WHERE id = $1
+ON CONFLICT (report_id) DO UPDATE SET data = EXCLUDED.data
+	`
+
+	getReportArchive = `
+SELECT a.data
+FROM report_archives a
+JOIN reports r ON r.id = a.report_id
+WHERE r.user_id = $1 AND a.report_id = $2
+	`
+
+	getAllReportArchives = `
+SELECT report_id, data FROM report_archives ORDER BY report_id
 	`
 
-	addRows = `
-INSERT INTO rows (report_id, date, task, link, time_spent) VALUES 
+	restoreReportArchive = `
+INSERT INTO report_archives (report_id, data) VALUES ($1, $2)
 	`
 )
@@ -1,19 +1,28 @@
 package postgres
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+
+	"github.com/BalanceBalls/report-generator/internal/report"
+)
 
 func (s *PostgresStorage) Seed() error {
-	usersSeed := `INSERT INTO users (id, gitlab_id, user_email, user_token, timezone_offset, is_active) VALUES (?, ?, ?, ?, ?, ?)`
+	ctx := context.Background()
 
-	if _, err := s.db.Exec(usersSeed, 1, 1238833, "TestEmail", "TestToken", 300, true); err != nil {
-		return fmt.Errorf("could not seed user data: %w", err)
+	// Users are added the regular way so their tokens get encrypted
+	usersSeed := []report.User{
+		{Id: 1, GitlabId: 1238833, UserEmail: "TestEmail", UserToken: "TestToken", TimezoneOffset: 300, IsActive: true},
+		{Id: 2, GitlabId: 9898989, UserEmail: "qwe@asd.com", UserToken: "asdfjkdf;la34i", TimezoneOffset: 300, IsActive: true},
 	}
 
-	if _, err := s.db.Exec(usersSeed, 2, 9898989, "qwe@asd.com", "asdfjkdf;la34i", 300, true); err != nil {
-		return fmt.Errorf("could not seed user data: %w", err)
+	for _, user := range usersSeed {
+		if err := s.AddUser(ctx, user); err != nil {
+			return fmt.Errorf("could not seed user data: %w", err)
+		}
 	}
 
-	reportsSeed := `INSERT INTO reports (user_id) VALUES (?)`
+	reportsSeed := `INSERT INTO reports (user_id) VALUES ($1)`
 
 	if _, reportsErr := s.db.Exec(reportsSeed, 1); reportsErr != nil {
 		return fmt.Errorf("could not seed reports data: %w", reportsErr)
@@ -23,7 +32,7 @@ func (s *PostgresStorage) Seed() error {
 		return fmt.Errorf("could not seed reports data: %w", reportsErr)
 	}
 
-	rowsSeed := `INSERT INTO rows (report_id, date, task, link, time_spent) VALUES (?, ?, ?, ?, ?)`
+	rowsSeed := `INSERT INTO rows (report_id, date, task, link, time_spent) VALUES ($1, $2, $3, $4, $5)`
 
 	if _, rowsErr := s.db.Exec(rowsSeed, 1, "2006-01-02T15:04:05Z", "#Casino/145", "http://git.casino.com/mr/i2ji4314uhiouhi4124l", 4.2); rowsErr != nil {
 		return fmt.Errorf("could not seed rows data: %w", rowsErr)
@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BalanceBalls/report-generator/internal/storage"
+)
+
+// Re-encrypts every stored token with the active key.
+// Used after a new key has been made active, old keys
+// must stay configured until rotation is finished
+func (s *PostgresStorage) RotateTokens(ctx context.Context) (int, error) {
+	return s.reencryptTokens(ctx, s.cipher.IsStale)
+}
+
+// Re-encrypts tokens of users and linked accounts matching the predicate
+// within a single transaction. Returns the number of updated tokens
+func (s *PostgresStorage) reencryptTokens(ctx context.Context, needsUpdate func(token string) bool) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	usersCnt, err := storage.ReencryptColumn(ctx, tx, s.cipher, getUserTokensForUpdate, updateUserToken, needsUpdate)
+	if err != nil {
+		return 0, fmt.Errorf("could not re-encrypt user tokens: %w", err)
+	}
+
+	accountsCnt, err := storage.ReencryptColumn(ctx, tx, s.cipher, getAccountTokensForUpdate, updateAccountToken, needsUpdate)
+	if err != nil {
+		return 0, fmt.Errorf("could not re-encrypt account tokens: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not commit transaction: %w", err)
+	}
+
+	return usersCnt + accountsCnt, nil
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Re-encrypts values of a single column matching the predicate with the cipher's active key
+// within the transaction. The select query must return row id and the value, the update query takes
+// the new value and row id. Returns the number of updated values
+func ReencryptColumn(
+	ctx context.Context, tx *sql.Tx, c *TokenCipher, selectQuery string, updateQuery string, needsUpdate func(string) bool,
+) (int, error) {
+	rows, err := tx.QueryContext(ctx, selectQuery)
+	if err != nil {
+		return 0, err
+	}
+
+	stale := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		if needsUpdate(value) {
+			stale[id] = value
+		}
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, value := range stale {
+		plain, err := c.Decrypt(value)
+		if err != nil {
+			return 0, fmt.Errorf("could not decrypt value of %d: %w", id, err)
+		}
+
+		encrypted, err := c.Encrypt(plain)
+		if err != nil {
+			return 0, fmt.Errorf("could not encrypt value of %d: %w", id, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, updateQuery, encrypted, id); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(stale), nil
+}
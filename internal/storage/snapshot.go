@@ -0,0 +1,22 @@
+package storage
+
+import "github.com/BalanceBalls/report-generator/internal/report"
+
+// Copy of everything stored, used by backups.
+// Tokens are kept encrypted exactly as they are stored,
+// so the snapshot can only be restored with the same encryption keys
+type Snapshot struct {
+	// Users with their linked accounts
+	Users []report.User
+	// Every version of every report with its rows
+	Reports []report.Report
+	// Raw git data of reports having it
+	Archives []ReportArchive
+}
+
+// Raw git data a report has been built from, kept to rebuild the report later
+type ReportArchive struct {
+	ReportId int64 `json:"reportId"`
+	// Encoded by the builder, storages keep it as is
+	Data []byte `json:"data"`
+}
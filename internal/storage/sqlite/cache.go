@@ -0,0 +1,40 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/BalanceBalls/report-generator/internal/storage"
+)
+
+func (s *SqliteStorage) CachedResponse(ctx context.Context, key string) (storage.CachedResponse, error) {
+	response := storage.CachedResponse{Key: key}
+	var storedAt sql.NullString
+
+	err := s.db.QueryRowContext(ctx, getCachedResponse, key).Scan(&response.Body, &response.ETag, &storedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.CachedResponse{}, storage.ErrCacheMiss
+	}
+
+	if err != nil {
+		return storage.CachedResponse{}, fmt.Errorf("could not fetch cached response: %w", err)
+	}
+
+	if response.StoredAt, err = parseTime(storedAt); err != nil {
+		return storage.CachedResponse{}, fmt.Errorf("could not parse cached response time: %w", err)
+	}
+
+	return response, nil
+}
+
+func (s *SqliteStorage) SaveCachedResponse(ctx context.Context, response storage.CachedResponse) error {
+	_, err := s.db.ExecContext(ctx, saveCachedResponse,
+		response.Key, response.Body, response.ETag, formatTime(response.StoredAt))
+	if err != nil {
+		return fmt.Errorf("could not save cached response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"log/slog"
+
+	"github.com/BalanceBalls/report-generator/internal/storage"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Applies pending migrations in order, each one in its own transaction.
+// Transactions hold the database write lock from the start,
+// so concurrent instances apply every migration only once
+func (s *SqliteStorage) Migrate(ctx context.Context) error {
+	migrations, err := storage.LoadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.ExecContext(ctx, createSchemaMigrationsTable); err != nil {
+		return fmt.Errorf("could not create table schema_migrations: %w", err)
+	}
+
+	for _, migration := range migrations {
+		applied, err := s.applyMigration(ctx, migration)
+		if err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		if applied {
+			slog.InfoContext(ctx, "migration applied", "version", migration.Version, "name", migration.Name)
+		}
+	}
+
+	return nil
+}
+
+// Returns migrations which have not been applied to the database yet
+func (s *SqliteStorage) PendingMigrations(ctx context.Context) ([]storage.Migration, error) {
+	migrations, err := storage.LoadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var tablesCnt int
+	if err := s.db.QueryRowContext(ctx, checkSchemaMigrationsExists).Scan(&tablesCnt); err != nil {
+		return nil, fmt.Errorf("could not check table schema_migrations: %w", err)
+	}
+
+	if tablesCnt == 0 {
+		return migrations, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, getAppliedMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("failed to fetch row: %w", err)
+		}
+		applied[version] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch applied migrations: %w", err)
+	}
+
+	return storage.PendingMigrations(migrations, applied), nil
+}
+
+func (s *SqliteStorage) applyMigration(ctx context.Context, migration storage.Migration) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var appliedCnt int
+	if err := tx.QueryRowContext(ctx, checkMigrationApplied, migration.Version).Scan(&appliedCnt); err != nil {
+		return false, fmt.Errorf("could not check migration: %w", err)
+	}
+
+	if appliedCnt > 0 {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, migration.Script); err != nil {
+		return false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, addAppliedMigration, migration.Version, migration.Name); err != nil {
+		return false, fmt.Errorf("could not record migration: %w", err)
+	}
+
+	return true, tx.Commit()
+}
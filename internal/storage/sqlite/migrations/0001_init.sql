@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS users (
+  id                INTEGER PRIMARY KEY,
+  gitlab_id         INTEGER,
+  user_email        TEXT,
+  user_token        TEXT,
+  timezone_offset   INTEGER,
+  is_active         BOOLEAN,
+  gitlab_host       TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS reports (
+  id      INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id INTEGER,
+
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS rows (
+  report_id   INTEGER,
+  date        TEXT,
+  task        TEXT,
+  link        TEXT,
+  time_spent  REAL,
+  source      TEXT,
+
+  FOREIGN KEY(report_id) REFERENCES reports(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS accounts (
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id      INTEGER,
+  provider     TEXT,
+  host         TEXT,
+  external_id  INTEGER,
+  token        TEXT,
+
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
@@ -0,0 +1,5 @@
+-- Dates are stored as RFC 3339 text, period is unknown for reports saved earlier
+ALTER TABLE reports ADD COLUMN period_start TEXT;
+ALTER TABLE reports ADD COLUMN period_end TEXT;
+ALTER TABLE reports ADD COLUMN source TEXT NOT NULL DEFAULT '';
+ALTER TABLE reports ADD COLUMN format TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,13 @@
+ALTER TABLE reports ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE reports ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+
+-- Reports saved earlier for the same period become its versions
+UPDATE reports SET version = numbered.version
+FROM (
+  SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id, period_start, period_end ORDER BY id) AS version
+  FROM reports
+  WHERE period_start IS NOT NULL AND period_end IS NOT NULL
+) numbered
+WHERE reports.id = numbered.id;
+
+CREATE UNIQUE INDEX reports_period_version_idx ON reports (user_id, period_start, period_end, version);
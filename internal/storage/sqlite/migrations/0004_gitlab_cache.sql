@@ -0,0 +1,6 @@
+CREATE TABLE gitlab_cache (
+  key       TEXT PRIMARY KEY,
+  body      BLOB NOT NULL,
+  etag      TEXT NOT NULL DEFAULT '',
+  stored_at TEXT NOT NULL
+);
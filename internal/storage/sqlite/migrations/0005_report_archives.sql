@@ -0,0 +1,4 @@
+CREATE TABLE report_archives (
+  report_id INTEGER PRIMARY KEY REFERENCES reports(id) ON DELETE CASCADE ON UPDATE CASCADE,
+  data      BLOB NOT NULL
+);
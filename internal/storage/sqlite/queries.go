@@ -0,0 +1,213 @@
+package sqlite
+
+const (
+	createSchemaMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  version     INTEGER PRIMARY KEY,
+  name        TEXT NOT NULL,
+  applied_at  TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+	getAppliedMigrations = `
+SELECT version FROM schema_migrations
+	`
+
+	checkMigrationApplied = `
+SELECT COUNT(*) FROM schema_migrations WHERE version = ?
+	`
+
+	checkSchemaMigrationsExists = `
+SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'
+	`
+
+	addAppliedMigration = `
+INSERT INTO schema_migrations (version, name) VALUES (?, ?)
+	`
+
+	getUserById = `
+SELECT 
+  id, gitlab_id, user_email, user_token, timezone_offset, is_active, gitlab_host 
+FROM users 
+WHERE id = ?
+	`
+
+	addUser = `
+INSERT INTO users (id, gitlab_id, user_email, user_token, timezone_offset, is_active, gitlab_host) 
+VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	updateUser = `
+UPDATE users SET 
+	gitlab_id = ?,
+	user_email = ?,
+	user_token = ?,
+	timezone_offset = ?,
+	gitlab_host = ?
+WHERE id = ?
+	`
+
+	removeUser = `
+DELETE FROM users
+WHERE id = ?
+	`
+
+	checkUserExists = `
+SELECT 1 FROM users
+WHERE id = ?
+	`
+
+	addReport = `
+INSERT INTO reports (user_id, period_start, period_end, source, format, version, content_hash)
+VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id
+	`
+
+	selectReports = `
+SELECT 
+  r.id, r.user_id, r.period_start, r.period_end, r.source, r.format, r.version, r.content_hash,
+  ro.date, ro.task, ro.link, ro.time_spent, ro.source
+FROM reports r
+  LEFT JOIN rows ro on ro.report_id = r.id
+`
+
+	// Only the latest version of every period
+	getReportsByUserId = selectReports + `
+WHERE r.user_id = ? AND NOT EXISTS (
+  SELECT 1 FROM reports newer
+  WHERE newer.user_id = r.user_id
+    AND newer.period_start = r.period_start
+    AND newer.period_end = r.period_end
+    AND newer.version > r.version
+)
+ORDER BY r.id, ro.date
+	`
+
+	getReportVersions = selectReports + `
+WHERE r.user_id = ? AND r.period_start = ? AND r.period_end = ?
+ORDER BY r.version, ro.date
+	`
+
+	getReportById = selectReports + `
+WHERE r.id = ?
+ORDER BY ro.date
+	`
+
+	getLatestReportVersion = `
+SELECT id, version, content_hash FROM reports
+WHERE user_id = ? AND period_start = ? AND period_end = ?
+ORDER BY version DESC
+LIMIT 1
+	`
+
+	addRow = `
+INSERT INTO rows (report_id, date, task, link, time_spent, source) VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	getAccountsByUserId = `
+SELECT 
+  id, user_id, provider, host, external_id, token
+FROM accounts
+WHERE user_id = ?
+ORDER BY id
+	`
+
+	addAccount = `
+INSERT INTO accounts (user_id, provider, host, external_id, token)
+VALUES (?, ?, ?, ?, ?) RETURNING id
+	`
+
+	removeAccount = `
+DELETE FROM accounts
+WHERE id = ? AND user_id = ?
+	`
+
+	getUserTokens = `
+SELECT id, user_token FROM users
+WHERE user_token <> ''
+	`
+
+	updateUserToken = `
+UPDATE users SET user_token = ? WHERE id = ?
+	`
+
+	getAccountTokens = `
+SELECT id, token FROM accounts
+WHERE token <> ''
+	`
+
+	updateAccountToken = `
+UPDATE accounts SET token = ? WHERE id = ?
+	`
+)
+
+// Backups
+const (
+	getAllUsers = `
+SELECT 
+  id, COALESCE(gitlab_id, 0), COALESCE(user_email, ''), COALESCE(user_token, ''),
+  COALESCE(timezone_offset, 0), COALESCE(is_active, false), gitlab_host
+FROM users
+ORDER BY id
+	`
+
+	getAllAccounts = `
+SELECT 
+  id, user_id, provider, host, external_id, token
+FROM accounts
+ORDER BY id
+	`
+
+	getAllReports = selectReports + `
+ORDER BY r.id, ro.date
+	`
+
+	checkStorageIsEmpty = `
+SELECT NOT EXISTS (SELECT 1 FROM users) AND NOT EXISTS (SELECT 1 FROM reports)
+	`
+
+	restoreAccount = `
+INSERT INTO accounts (id, user_id, provider, host, external_id, token)
+VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	restoreReport = `
+INSERT INTO reports (id, user_id, period_start, period_end, source, format, version, content_hash)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+)
+
+// Gitlab responses cache
+const (
+	getCachedResponse = `
+SELECT body, etag, stored_at FROM gitlab_cache WHERE key = ?
+	`
+
+	saveCachedResponse = `
+INSERT INTO gitlab_cache (key, body, etag, stored_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (key) DO UPDATE SET body = EXCLUDED.body, etag = EXCLUDED.etag, stored_at = EXCLUDED.stored_at
+	`
+)
+
+// Raw git data of reports
+const (
+	saveReportArchive = `
+INSERT INTO report_archives (report_id, data)
+SELECT id, ? FROM reports WHERE id = ?
+ON CONFLICT (report_id) DO UPDATE SET data = EXCLUDED.data
+	`
+
+	getReportArchive = `
+SELECT a.data
+FROM report_archives a
+JOIN reports r ON r.id = a.report_id
+WHERE r.user_id = ? AND a.report_id = ?
+	`
+
+	getAllReportArchives = `
+SELECT report_id, data FROM report_archives ORDER BY report_id
+	`
+
+	restoreReportArchive = `
+INSERT INTO report_archives (report_id, data) VALUES (?, ?)
+	`
+)
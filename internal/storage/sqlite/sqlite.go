@@ -0,0 +1,414 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/BalanceBalls/report-generator/internal/logger"
+	"github.com/BalanceBalls/report-generator/internal/report"
+	"github.com/BalanceBalls/report-generator/internal/storage"
+)
+
+// Foreign keys are disabled in SQLite by default and cascade deletes rely on them.
+// Transactions take the write lock right away so concurrent writers wait for each other
+const connectionParams = "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate"
+
+type SqliteStorage struct {
+	db     *sql.DB
+	cipher *storage.TokenCipher
+}
+
+func New(path string, cipher *storage.TokenCipher) (*SqliteStorage, error) {
+	slog.Info("initializing SQLite DB...", "path", path)
+	db, err := sql.Open("sqlite", "file:"+path+connectionParams)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not open database:  %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("could not access database: %w", err)
+	}
+
+	return &SqliteStorage{db: db, cipher: cipher}, nil
+}
+
+func (s *SqliteStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *SqliteStorage) Close() error {
+	return s.db.Close()
+}
+
+func (s *SqliteStorage) Up(ctx context.Context) error {
+	if err := s.Migrate(ctx); err != nil {
+		return fmt.Errorf("could not migrate database: %w", err)
+	}
+
+	encrypted, err := s.reencryptTokens(ctx, func(token string) bool {
+		return token != "" && !storage.IsEncrypted(token)
+	})
+	if err != nil {
+		return fmt.Errorf("could not encrypt stored tokens: %w", err)
+	}
+
+	if encrypted > 0 {
+		slog.InfoContext(ctx, "plain text tokens have been encrypted", "count", encrypted)
+	}
+
+	return nil
+}
+
+func (s *SqliteStorage) AddUser(ctx context.Context, user report.User) error {
+	token, err := s.cipher.Encrypt(user.UserToken)
+	if err != nil {
+		return fmt.Errorf("could not encrypt user token: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, addUser,
+		user.Id, user.GitlabId, user.UserEmail, token, user.TimezoneOffset, user.IsActive, user.GitlabHost)
+	if err != nil {
+		return fmt.Errorf("could not add new user: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SqliteStorage) UserExists(ctx context.Context, userId int64) bool {
+	logger := logger.GetFromContext(ctx)
+
+	var exists int
+	err := s.db.QueryRowContext(ctx, checkUserExists, userId).Scan(&exists)
+
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			logger.ErrorContext(ctx, err.Error())
+		}
+
+		return false
+	}
+
+	return true
+}
+
+func (s *SqliteStorage) User(ctx context.Context, userId int64) (report.User, error) {
+	user := report.User{}
+	err := s.db.QueryRowContext(ctx, getUserById, userId).Scan(
+		&user.Id, &user.GitlabId, &user.UserEmail, &user.UserToken, &user.TimezoneOffset, &user.IsActive, &user.GitlabHost)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return report.User{}, storage.ErrUserNotFound
+		}
+
+		return report.User{}, fmt.Errorf("failed to fetch row: %w", err)
+	}
+
+	user.UserToken, err = s.cipher.Decrypt(user.UserToken)
+	if err != nil {
+		return report.User{}, fmt.Errorf("could not decrypt user token: %w", err)
+	}
+
+	return user, nil
+}
+
+func (s *SqliteStorage) UpdateUser(ctx context.Context, user report.User) error {
+	token, err := s.cipher.Encrypt(user.UserToken)
+	if err != nil {
+		return fmt.Errorf("could not encrypt user token: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, updateUser,
+		user.GitlabId, user.UserEmail, token, user.TimezoneOffset, user.GitlabHost, user.Id)
+	if err != nil {
+		return fmt.Errorf("could not update user: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SqliteStorage) RemoveUser(ctx context.Context, userId int64) error {
+	_, err := s.db.ExecContext(ctx, removeUser, userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SqliteStorage) Accounts(ctx context.Context, userId int64) ([]report.Account, error) {
+	rows, err := s.db.QueryContext(ctx, getAccountsByUserId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch accounts: %w", err)
+	}
+	defer rows.Close()
+
+	result := []report.Account{}
+	for rows.Next() {
+		account := report.Account{}
+		err := rows.Scan(&account.Id, &account.UserId, &account.Provider, &account.Host, &account.ExternalId, &account.Token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch row: %w", err)
+		}
+
+		account.Token, err = s.cipher.Decrypt(account.Token)
+		if err != nil {
+			return nil, fmt.Errorf("could not decrypt account token: %w", err)
+		}
+
+		result = append(result, account)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch accounts: %w", err)
+	}
+
+	return result, nil
+}
+
+func (s *SqliteStorage) AddAccount(ctx context.Context, account report.Account) (int64, error) {
+	token, err := s.cipher.Encrypt(account.Token)
+	if err != nil {
+		return 0, fmt.Errorf("could not encrypt account token: %w", err)
+	}
+
+	var id int64
+	err = s.db.QueryRowContext(ctx, addAccount,
+		account.UserId, account.Provider, account.Host, account.ExternalId, token).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("could not add account: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *SqliteStorage) RemoveAccount(ctx context.Context, userId int64, accountId int64) error {
+	res, err := s.db.ExecContext(ctx, removeAccount, accountId, userId)
+	if err != nil {
+		return fmt.Errorf("could not remove account: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not remove account: %w", err)
+	}
+
+	if affected == 0 {
+		return storage.ErrAccountNotFound
+	}
+
+	return nil
+}
+
+// Saves the report with its rows in a single transaction and returns the stored report.
+// A report regenerated for the same period becomes its new version when the rows differ
+// from the latest version. Otherwise the latest version is returned as is, keeping its manual edits
+func (s *SqliteStorage) SaveReport(ctx context.Context, r report.Report, userId int64) (report.Report, error) {
+	// Immediate transaction holds the write lock, so concurrent saves can not pick the same version
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return report.Report{}, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	r.Version = 1
+	r.ContentHash = r.Hash()
+
+	if r.HasPeriod() {
+		var latestId int64
+		var latestVersion int
+		var latestHash string
+		err := tx.QueryRowContext(ctx, getLatestReportVersion,
+			userId, formatTime(r.PeriodStart), formatTime(r.PeriodEnd)).
+			Scan(&latestId, &latestVersion, &latestHash)
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return report.Report{}, fmt.Errorf("could not fetch latest report version: %w", err)
+		case latestHash == r.ContentHash:
+			return reportById(ctx, tx, latestId)
+		default:
+			r.Version = latestVersion + 1
+		}
+	}
+
+	var reportId int64
+	err = tx.QueryRowContext(ctx, addReport,
+		userId, formatTime(r.PeriodStart), formatTime(r.PeriodEnd), r.Source, r.Format, r.Version, r.ContentHash).
+		Scan(&reportId)
+	if err != nil {
+		return report.Report{}, fmt.Errorf("could not add report: %w", err)
+	}
+
+	for _, reportRow := range r.Rows {
+		_, err := tx.ExecContext(ctx, addRow,
+			reportId, formatTime(reportRow.Date), reportRow.Task, reportRow.Link, reportRow.TimeSpent, reportRow.Source)
+		if err != nil {
+			return report.Report{}, fmt.Errorf("could not add report row: %w", err)
+		}
+	}
+
+	saved, err := reportById(ctx, tx, reportId)
+	if err != nil {
+		return report.Report{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return report.Report{}, fmt.Errorf("could not commit transaction: %w", err)
+	}
+
+	return saved, nil
+}
+
+// Returns the latest version of every report of the user ordered by creation
+func (s *SqliteStorage) Reports(ctx context.Context, userId int64) ([]report.Report, error) {
+	rows, err := s.db.QueryContext(ctx, getReportsByUserId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch reports: %w", err)
+	}
+
+	return collectReports(rows)
+}
+
+// Returns every version of the user's report for the period ordered by version
+func (s *SqliteStorage) ReportVersions(
+	ctx context.Context, userId int64, periodStart time.Time, periodEnd time.Time,
+) ([]report.Report, error) {
+	rows, err := s.db.QueryContext(ctx, getReportVersions, userId, formatTime(periodStart), formatTime(periodEnd))
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch report versions: %w", err)
+	}
+
+	return collectReports(rows)
+}
+
+func reportById(ctx context.Context, tx *sql.Tx, reportId int64) (report.Report, error) {
+	rows, err := tx.QueryContext(ctx, getReportById, reportId)
+	if err != nil {
+		return report.Report{}, fmt.Errorf("could not fetch report: %w", err)
+	}
+
+	reports, err := collectReports(rows)
+	if err != nil {
+		return report.Report{}, err
+	}
+
+	if len(reports) == 0 {
+		return report.Report{}, fmt.Errorf("report %d has not been found", reportId)
+	}
+
+	return reports[0], nil
+}
+
+// Groups joined report and row records into reports, closes rows
+func collectReports(rows *sql.Rows) ([]report.Report, error) {
+	defer rows.Close()
+
+	result := []report.Report{}
+	for rows.Next() {
+		var header report.Report
+		var periodStart, periodEnd, rawDate, task, link, source sql.NullString
+		var timeSpent sql.NullFloat64
+
+		err := rows.Scan(
+			&header.Id, &header.UserId, &periodStart, &periodEnd, &header.Source, &header.Format,
+			&header.Version, &header.ContentHash,
+			&rawDate, &task, &link, &timeSpent, &source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch row: %w", err)
+		}
+
+		if len(result) == 0 || result[len(result)-1].Id != header.Id {
+			if header.PeriodStart, err = parseTime(periodStart); err != nil {
+				return nil, fmt.Errorf("failed to parse report period: %w", err)
+			}
+
+			if header.PeriodEnd, err = parseTime(periodEnd); err != nil {
+				return nil, fmt.Errorf("failed to parse report period: %w", err)
+			}
+
+			result = append(result, header)
+		}
+
+		// Report without rows
+		if !rawDate.Valid {
+			continue
+		}
+
+		date, err := parseTime(rawDate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse row date: %w", err)
+		}
+
+		current := &result[len(result)-1]
+		current.Rows = append(current.Rows, report.ReportRow{
+			ReportId:  header.Id,
+			Date:      date,
+			Task:      task.String,
+			Link:      link.String,
+			TimeSpent: float32(timeSpent.Float64),
+			Source:    source.String,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch reports: %w", err)
+	}
+
+	return result, nil
+}
+
+// Re-encrypts every stored token with the active key
+func (s *SqliteStorage) RotateTokens(ctx context.Context) (int, error) {
+	return s.reencryptTokens(ctx, s.cipher.IsStale)
+}
+
+func (s *SqliteStorage) reencryptTokens(ctx context.Context, needsUpdate func(token string) bool) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	usersCnt, err := storage.ReencryptColumn(ctx, tx, s.cipher, getUserTokens, updateUserToken, needsUpdate)
+	if err != nil {
+		return 0, fmt.Errorf("could not re-encrypt user tokens: %w", err)
+	}
+
+	accountsCnt, err := storage.ReencryptColumn(ctx, tx, s.cipher, getAccountTokens, updateAccountToken, needsUpdate)
+	if err != nil {
+		return 0, fmt.Errorf("could not re-encrypt account tokens: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not commit transaction: %w", err)
+	}
+
+	return usersCnt + accountsCnt, nil
+}
+
+// Dates are stored as RFC 3339 text in UTC so equal moments compare equal as text,
+// zero time is stored as NULL
+func formatTime(t time.Time) sql.NullString {
+	return sql.NullString{String: t.UTC().Format(time.RFC3339Nano), Valid: !t.IsZero()}
+}
+
+func parseTime(raw sql.NullString) (time.Time, error) {
+	if !raw.Valid {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339Nano, raw.String)
+}
@@ -20,6 +20,7 @@ type FlatUser struct {
 	Task           string
 	Link           string
 	TimeSpent      float32
+	Source         string
 }
 
 type ConvertableUsers struct {
@@ -58,6 +59,7 @@ func (cu *ConvertableUsers) Convert() []report.User {
 				Task:      fu.Task,
 				Link:      fu.Link,
 				TimeSpent: fu.TimeSpent,
+				Source:    fu.Source,
 			}
 
 			tReport.Rows = append(tReport.Rows, tRow)
@@ -69,3 +71,4 @@ func (cu *ConvertableUsers) Convert() []report.User {
 
 	return result
 }
+